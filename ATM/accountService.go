@@ -0,0 +1,286 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const maxPinAttempts = 3
+
+var (
+	ErrAccountNotFound = errors.New("Account does not exist")
+	ErrIncorrectPin    = errors.New("Incorrect PIN")
+	ErrCardBlocked     = errors.New("Card blocked")
+
+	ErrInvalidAmount     = errors.New("Invalid amount")
+	ErrInsufficientFunds = errors.New("Insufficient funds")
+)
+
+type Account struct {
+	id       string
+	userId   string
+	pin      pinHash
+	balance  int
+	limits   WithdrawalLimits
+	location *time.Location // daily limits reset at midnight here
+	usage    dailyUsage
+	history  []AccountTransaction
+	mu       sync.Mutex
+}
+
+// AccountService is safe for concurrent use, so several AtmMachines can
+// share one instance. The service lock guards its maps; each account has its
+// own lock for balance changes.
+type AccountService struct {
+	accounts       map[string]*Account // accountId -> account
+	userAccounts   map[string][]string // userId -> accountIds
+	cards          map[string]*Card    // card number -> card
+	failedAttempts map[string]int      // card number -> consecutive wrong PINs
+	blockedCards   map[string]bool
+	clock          Clock
+	pinPolicy      PinPolicy
+	accountSeq     atomic.Int64
+	cardSeq        atomic.Int64
+	txnSeq         atomic.Int64
+	mu             sync.RWMutex
+}
+
+func NewAccountService() *AccountService {
+	return &AccountService{
+		accounts:       make(map[string]*Account),
+		userAccounts:   make(map[string][]string),
+		cards:          make(map[string]*Card),
+		failedAttempts: make(map[string]int),
+		blockedCards:   make(map[string]bool),
+		clock:          realClock{},
+		pinPolicy:      DefaultPinPolicy,
+	}
+}
+
+func (s *AccountService) SetClock(c Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clock = c
+}
+
+func (s *AccountService) now() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.clock.Now()
+}
+
+// CreateAccount opens a new account for userId. A user may hold any number
+// of accounts.
+func (s *AccountService) CreateAccount(userId string, pin string, openingBalance int) (*Account, error) {
+	if err := s.PinPolicy().Validate(pin); err != nil {
+		return nil, err
+	}
+	hashedPin, err := newPinHash(pin)
+	if err != nil {
+		return nil, err
+	}
+
+	newAccount := &Account{
+		id:       fmt.Sprintf("ACC%08d", s.accountSeq.Add(1)),
+		userId:   userId,
+		pin:      hashedPin,
+		balance:  openingBalance,
+		limits:   DefaultWithdrawalLimits,
+		location: time.UTC,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accounts[newAccount.id] = newAccount
+	s.userAccounts[userId] = append(s.userAccounts[userId], newAccount.id)
+
+	return newAccount, nil
+}
+
+// IssueCard creates a card bound to accountId.
+func (s *AccountService) IssueCard(accountId string) (*Card, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, ok := s.accounts[accountId]
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+
+	newCard := &Card{
+		number:    fmt.Sprintf("4000%012d", s.cardSeq.Add(1)),
+		userId:    account.userId,
+		accountId: account.id,
+	}
+	s.cards[newCard.number] = newCard
+	return newCard, nil
+}
+
+func (s *AccountService) GetAccount(accountId string, pin string) (*Account, error) {
+	s.mu.RLock()
+	account, ok := s.accounts[accountId]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+
+	account.mu.Lock()
+	defer account.mu.Unlock()
+	if !account.pin.matches(pin) {
+		return nil, ErrIncorrectPin
+	}
+	return account, nil
+}
+
+func (s *AccountService) GetAccounts(userId string) []*Account {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	accounts := make([]*Account, 0, len(s.userAccounts[userId]))
+	for _, id := range s.userAccounts[userId] {
+		accounts = append(accounts, s.accounts[id])
+	}
+	return accounts
+}
+
+// VerifyPin checks pin against the card's account. The card is blocked after
+// maxPinAttempts consecutive failures; a correct PIN resets the count.
+func (s *AccountService) VerifyPin(c *Card, pin string) (*Account, error) {
+	if s.IsBlocked(c) {
+		return nil, ErrCardBlocked
+	}
+
+	account, err := s.GetAccount(c.accountId, pin)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if errors.Is(err, ErrIncorrectPin) {
+		s.failedAttempts[c.number]++
+		remaining := maxPinAttempts - s.failedAttempts[c.number]
+		if remaining <= 0 {
+			s.blockedCards[c.number] = true
+			return nil, ErrCardBlocked
+		}
+		return nil, fmt.Errorf("%w, %d attempts remaining", err, remaining)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// a concurrent wrong attempt may have blocked the card since the check
+	// above
+	if s.blockedCards[c.number] {
+		return nil, ErrCardBlocked
+	}
+
+	delete(s.failedAttempts, c.number)
+	return account, nil
+}
+
+// ChangePin replaces the PIN of the card's account. The old PIN is checked
+// like any other PIN entry, so wrong guesses count towards blocking the card.
+func (s *AccountService) ChangePin(c *Card, oldPin, newPin string) error {
+	account, err := s.VerifyPin(c, oldPin)
+	if err != nil {
+		return err
+	}
+	if err := s.PinPolicy().Validate(newPin); err != nil {
+		return err
+	}
+	if oldPin == newPin {
+		return ErrSamePin
+	}
+
+	hashedPin, err := newPinHash(newPin)
+	if err != nil {
+		return err
+	}
+
+	account.mu.Lock()
+	defer account.mu.Unlock()
+	account.pin = hashedPin
+	return nil
+}
+
+func (s *AccountService) SetPinPolicy(p PinPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pinPolicy = p
+}
+
+func (s *AccountService) PinPolicy() PinPolicy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.pinPolicy
+}
+
+func (s *AccountService) IsBlocked(c *Card) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.blockedCards[c.number]
+}
+
+func (s *AccountService) Balance(a *Account) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.balance
+}
+
+func (s *AccountService) SetWithdrawalLimits(a *Account, limits WithdrawalLimits) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.limits = limits
+}
+
+func (s *AccountService) SetTimezone(a *Account, loc *time.Location) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.location = loc
+}
+
+func (s *AccountService) Withdraw(a *Account, amt int) (int, error) {
+	now := s.now()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if amt <= 0 {
+		return a.balance, ErrInvalidAmount
+	}
+	if err := a.checkLimits(amt, now); err != nil {
+		return a.balance, err
+	}
+	if amt > a.balance {
+		return a.balance, fmt.Errorf("%w: balance %d, requested %d", ErrInsufficientFunds, a.balance, amt)
+	}
+	a.balance -= amt
+	a.recordWithdrawal(amt)
+	a.addTransaction(s.newTransaction(DEBIT, "Cash withdrawal", amt, a.balance, now))
+	return a.balance, nil
+}
+
+// CreditAccount adds verified funds to an account.
+func (s *AccountService) CreditAccount(accountId string, amt int, description string) error {
+	s.mu.RLock()
+	a, ok := s.accounts[accountId]
+	s.mu.RUnlock()
+
+	if !ok {
+		return ErrAccountNotFound
+	}
+	if amt <= 0 {
+		return ErrInvalidAmount
+	}
+
+	now := s.now()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.balance += amt
+	a.addTransaction(s.newTransaction(CREDIT, description, amt, a.balance, now))
+	return nil
+}
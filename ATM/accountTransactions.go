@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const maxAccountHistory = 100
+
+var ErrSameAccount = errors.New("Cannot transfer to the same account")
+
+type EntryType string
+
+const (
+	DEBIT  EntryType = "DEBIT"
+	CREDIT EntryType = "CREDIT"
+)
+
+type AccountTransaction struct {
+	Id          string
+	Type        EntryType
+	Description string
+	Amount      int
+	Balance     int // balance after this transaction
+	Timestamp   time.Time
+}
+
+// addTransaction must be called with a.mu held.
+func (a *Account) addTransaction(t AccountTransaction) {
+	a.history = append(a.history, t)
+	if len(a.history) > maxAccountHistory {
+		a.history = a.history[len(a.history)-maxAccountHistory:]
+	}
+}
+
+func (s *AccountService) newTransaction(entryType EntryType, description string, amt, balance int, now time.Time) AccountTransaction {
+	return AccountTransaction{
+		Id:          fmt.Sprintf("TXN%010d", s.txnSeq.Add(1)),
+		Type:        entryType,
+		Description: description,
+		Amount:      amt,
+		Balance:     balance,
+		Timestamp:   now,
+	}
+}
+
+// Transfer moves amt from one account to another. Both accounts are locked
+// in id order for the whole move, so concurrent transfers can neither
+// deadlock nor leave a debit without its credit.
+func (s *AccountService) Transfer(from *Account, toAccountId string, amt int) (int, error) {
+	s.mu.RLock()
+	to, ok := s.accounts[toAccountId]
+	s.mu.RUnlock()
+
+	if !ok {
+		return s.Balance(from), ErrAccountNotFound
+	}
+	if to == from {
+		return s.Balance(from), ErrSameAccount
+	}
+
+	first, second := from, to
+	if second.id < first.id {
+		first, second = second, first
+	}
+	first.mu.Lock()
+	defer first.mu.Unlock()
+	second.mu.Lock()
+	defer second.mu.Unlock()
+
+	if amt <= 0 {
+		return from.balance, ErrInvalidAmount
+	}
+	if amt > from.balance {
+		return from.balance, fmt.Errorf("%w: balance %d, requested %d", ErrInsufficientFunds, from.balance, amt)
+	}
+
+	now := s.now()
+	from.balance -= amt
+	to.balance += amt
+	from.addTransaction(s.newTransaction(DEBIT, "Transfer to "+to.id, amt, from.balance, now))
+	to.addTransaction(s.newTransaction(CREDIT, "Transfer from "+from.id, amt, to.balance, now))
+
+	return from.balance, nil
+}
+
+// MiniStatement returns the last n transactions, most recent first.
+func (s *AccountService) MiniStatement(a *Account, n int) []AccountTransaction {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if n <= 0 || n > len(a.history) {
+		n = len(a.history)
+	}
+
+	statement := make([]AccountTransaction, 0, n)
+	for i := len(a.history) - 1; i >= len(a.history)-n; i-- {
+		statement = append(statement, a.history[i])
+	}
+	return statement
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var DefaultDenominations = []int{2000, 500, 200, 100}
+
+var (
+	ErrCannotDispense      = errors.New("Cannot dispense amount with available notes")
+	ErrUnknownDenomination = errors.New("Unknown denomination")
+)
+
+// NoteDispenser is one link in the dispensing chain. Each link takes as many
+// notes of its denomination as it can and hands the rest to the next link,
+// taking fewer notes when the rest of the chain cannot make up the remainder.
+type NoteDispenser struct {
+	denomination int
+	next         *NoteDispenser
+}
+
+func (d *NoteDispenser) plan(amt int, available map[int]int, out map[int]int) bool {
+	maxNotes := amt / d.denomination
+	if available[d.denomination] < maxNotes {
+		maxNotes = available[d.denomination]
+	}
+
+	for n := maxNotes; n >= 0; n-- {
+		remaining := amt - n*d.denomination
+		if remaining == 0 || (d.next != nil && d.next.plan(remaining, available, out)) {
+			if n > 0 {
+				out[d.denomination] = n
+			}
+			return true
+		}
+	}
+	return false
+}
+
+type LowCashAlert struct {
+	Denomination int
+	Remaining    int
+}
+
+// CashCassette holds the notes loaded into a machine.
+type CashCassette struct {
+	notes        map[int]int // denomination -> count
+	chain        *NoteDispenser
+	lowThreshold int
+	listeners    []func(LowCashAlert)
+	mu           sync.Mutex
+}
+
+func NewCashCassette(denominations ...int) *CashCassette {
+	if len(denominations) == 0 {
+		denominations = DefaultDenominations
+	}
+	sorted := append([]int(nil), denominations...)
+	sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+
+	c := &CashCassette{
+		notes:        make(map[int]int),
+		lowThreshold: 10,
+	}
+
+	// build the chain from the smallest note up so the largest is the head
+	for i := len(sorted) - 1; i >= 0; i-- {
+		c.notes[sorted[i]] = 0
+		c.chain = &NoteDispenser{denomination: sorted[i], next: c.chain}
+	}
+	return c
+}
+
+func (c *CashCassette) Accepts(denomination int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.notes[denomination]
+	return ok
+}
+
+func (c *CashCassette) Refill(denomination, count int) error {
+	if count <= 0 {
+		return ErrInvalidAmount
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.notes[denomination]; !ok {
+		return fmt.Errorf("%w: %d", ErrUnknownDenomination, denomination)
+	}
+	c.notes[denomination] += count
+	return nil
+}
+
+// Dispense removes notes adding up to amt. Either the full amount is taken
+// or the cassette is left untouched.
+func (c *CashCassette) Dispense(amt int) (map[int]int, error) {
+	notes, err := c.Reserve(amt)
+	if err != nil {
+		return nil, err
+	}
+	c.Commit(notes)
+	return notes, nil
+}
+
+// Reserve sets aside notes adding up to amt without raising low-cash alerts.
+// The caller must either Commit the notes once they are paid out or Restock
+// them.
+func (c *CashCassette) Reserve(amt int) (map[int]int, error) {
+	if amt <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	notes := make(map[int]int)
+	if c.chain == nil || !c.chain.plan(amt, c.notes, notes) {
+		return nil, fmt.Errorf("%w: %d", ErrCannotDispense, amt)
+	}
+	for denomination, count := range notes {
+		c.notes[denomination] -= count
+	}
+	return notes, nil
+}
+
+// Commit confirms reserved notes were paid out and fires a LowCashAlert for
+// each denomination the payout took below the threshold.
+func (c *CashCassette) Commit(notes map[int]int) {
+	c.mu.Lock()
+	var alerts []LowCashAlert
+	for denomination, count := range notes {
+		after := c.notes[denomination]
+		if after+count >= c.lowThreshold && after < c.lowThreshold {
+			alerts = append(alerts, LowCashAlert{Denomination: denomination, Remaining: after})
+		}
+	}
+	listeners := c.listeners
+	c.mu.Unlock()
+
+	for _, alert := range alerts {
+		for _, fn := range listeners {
+			fn(alert)
+		}
+	}
+}
+
+// Restock puts back notes that were dispensed but never handed out.
+func (c *CashCassette) Restock(notes map[int]int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for denomination, count := range notes {
+		c.notes[denomination] += count
+	}
+}
+
+func (c *CashCassette) Counts() map[int]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := make(map[int]int, len(c.notes))
+	for denomination, count := range c.notes {
+		counts[denomination] = count
+	}
+	return counts
+}
+
+func (c *CashCassette) Total() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	total := 0
+	for denomination, count := range c.notes {
+		total += denomination * count
+	}
+	return total
+}
+
+// SetLowCashThreshold sets the note count below which a denomination raises
+// a LowCashAlert.
+func (c *CashCassette) SetLowCashThreshold(count int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lowThreshold = count
+}
+
+func (c *CashCassette) OnLowCash(fn func(LowCashAlert)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.listeners = append(c.listeners, fn)
+}
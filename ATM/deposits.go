@@ -0,0 +1,291 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNoNotes = errors.New("No notes inserted")
+
+// Note is one banknote as read by the machine's note validator.
+type Note struct {
+	Denomination int
+	Counterfeit  bool
+}
+
+// CashDeposit is the cash the user put into the deposit slot along with the
+// amount they declared.
+type CashDeposit struct {
+	Declared int
+	Notes    []Note
+}
+
+type DepositStatus string
+
+const (
+	PENDING  DepositStatus = "PENDING"  // waiting for the hold period to pass
+	CREDITED DepositStatus = "CREDITED" // counted amount matched the declared amount
+	ADJUSTED DepositStatus = "ADJUSTED" // counted amount credited, declared amount differed
+	REJECTED DepositStatus = "REJECTED" // nothing genuine to credit
+)
+
+type PendingDeposit struct {
+	Id          string
+	MachineId   string
+	AccountId   string
+	CardNumber  string // masked
+	Declared    int
+	Counted     int // value of genuine notes, set on verification
+	Notes       []Note
+	Counterfeit []Note
+	Status      DepositStatus
+	DepositedAt time.Time
+	ReleaseAt   time.Time
+	VerifiedAt  time.Time
+
+	cardKey string
+}
+
+// DepositBin holds every deposit a machine has taken in since it was last
+// emptied.
+type DepositBin struct {
+	deposits []*PendingDeposit
+	seq      int
+	mu       sync.Mutex
+}
+
+func NewDepositBin() *DepositBin {
+	return &DepositBin{
+		deposits: make([]*PendingDeposit, 0),
+	}
+}
+
+func (b *DepositBin) add(d *PendingDeposit) *PendingDeposit {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	d.Id = fmt.Sprintf("%s-DEP%05d", d.MachineId, b.seq)
+	b.deposits = append(b.deposits, d)
+	return d
+}
+
+// due returns the pending deposits whose hold period has passed.
+func (b *DepositBin) due(now time.Time) []*PendingDeposit {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ready := make([]*PendingDeposit, 0)
+	for _, d := range b.deposits {
+		if d.Status == PENDING && !now.Before(d.ReleaseAt) {
+			ready = append(ready, d)
+		}
+	}
+	return ready
+}
+
+func (b *DepositBin) Deposits() []PendingDeposit {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	out := make([]PendingDeposit, 0, len(b.deposits))
+	for _, d := range b.deposits {
+		out = append(out, *d)
+	}
+	return out
+}
+
+// verify counts the notes of d, credits the genuine amount and records the
+// outcome. Counterfeit notes stay in the bin and are never credited.
+func (b *DepositBin) verify(d *PendingDeposit, srv *AccountService, now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if d.Status != PENDING {
+		return nil
+	}
+
+	counted := 0
+	counterfeit := make([]Note, 0)
+	for _, n := range d.Notes {
+		if n.Counterfeit {
+			counterfeit = append(counterfeit, n)
+			continue
+		}
+		counted += n.Denomination
+	}
+
+	d.Counted = counted
+	d.Counterfeit = counterfeit
+	d.VerifiedAt = now
+
+	if counted == 0 {
+		d.Status = REJECTED
+		return nil
+	}
+	if err := srv.CreditAccount(d.AccountId, counted, "Cash deposit "+d.Id); err != nil {
+		return err
+	}
+	if counted == d.Declared {
+		d.Status = CREDITED
+	} else {
+		d.Status = ADJUSTED
+	}
+	return nil
+}
+
+type DepositReconciliation struct {
+	Deposits         int
+	Pending          int
+	DeclaredTotal    int
+	CountedTotal     int
+	PendingTotal     int // declared value still on hold
+	GenuineNotes     map[int]int
+	CounterfeitNotes map[int]int
+	CounterfeitValue int
+	Discrepancies    []PendingDeposit // verified deposits where counted != declared
+	GeneratedAt      time.Time
+}
+
+// Reconcile summarises what should physically be in the bin against what
+// customers declared.
+func (b *DepositBin) Reconcile(now time.Time) *DepositReconciliation {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	r := &DepositReconciliation{
+		GenuineNotes:     make(map[int]int),
+		CounterfeitNotes: make(map[int]int),
+		Discrepancies:    make([]PendingDeposit, 0),
+		GeneratedAt:      now,
+	}
+	for _, d := range b.deposits {
+		r.Deposits++
+		r.DeclaredTotal += d.Declared
+
+		if d.Status == PENDING {
+			r.Pending++
+			r.PendingTotal += d.Declared
+		}
+		for _, n := range d.Notes {
+			if n.Counterfeit {
+				r.CounterfeitNotes[n.Denomination]++
+				r.CounterfeitValue += n.Denomination
+			} else {
+				r.GenuineNotes[n.Denomination]++
+			}
+		}
+		if d.Status != PENDING {
+			r.CountedTotal += d.Counted
+			if d.Counted != d.Declared {
+				r.Discrepancies = append(r.Discrepancies, *d)
+			}
+		}
+	}
+	return r
+}
+
+func (r *DepositReconciliation) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Deposit bin reconciliation at %s\n", r.GeneratedAt.Format(time.RFC3339))
+	fmt.Fprintf(&sb, "  deposits        : %d (%d pending)\n", r.Deposits, r.Pending)
+	fmt.Fprintf(&sb, "  declared total  : %d\n", r.DeclaredTotal)
+	fmt.Fprintf(&sb, "  counted total   : %d\n", r.CountedTotal)
+	fmt.Fprintf(&sb, "  on hold         : %d\n", r.PendingTotal)
+	fmt.Fprintf(&sb, "  counterfeit     : %d\n", r.CounterfeitValue)
+
+	denominations := make([]int, 0, len(r.GenuineNotes))
+	for d := range r.GenuineNotes {
+		denominations = append(denominations, d)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(denominations)))
+	for _, d := range denominations {
+		fmt.Fprintf(&sb, "    %4d x %d\n", d, r.GenuineNotes[d])
+	}
+
+	for _, d := range r.Discrepancies {
+		fmt.Fprintf(&sb, "  discrepancy %s: declared %d, counted %d (%s)\n", d.Id, d.Declared, d.Counted, d.Status)
+	}
+	return sb.String()
+}
+
+func (atm *AtmMachine) SetDepositHold(d time.Duration) {
+	atm.mu.Lock()
+	defer atm.mu.Unlock()
+	atm.depositHold = d
+}
+
+func (atm *AtmMachine) DepositBin() *DepositBin {
+	return atm.depositBin
+}
+
+// VerifyDeposits credits every deposit whose hold period has passed.
+func (atm *AtmMachine) VerifyDeposits() []PendingDeposit {
+	atm.mu.Lock()
+	defer atm.mu.Unlock()
+	return atm.verifyDeposits()
+}
+
+func (atm *AtmMachine) verifyDeposits() []PendingDeposit {
+	now := atm.now()
+
+	verified := make([]PendingDeposit, 0)
+	for _, d := range atm.depositBin.due(now) {
+		err := atm.depositBin.verify(d, atm.accService, now)
+		atm.journal.Append(JournalEntry{
+			MachineId:  atm.id,
+			CardNumber: d.CardNumber,
+			Event:      DEPOSIT_VERIFIED,
+			Outcome:    depositOutcome(d, err),
+			Amount:     d.Counted,
+			Detail:     fmt.Sprintf("%s declared %d counted %d", d.Id, d.Declared, d.Counted),
+			Timestamp:  now,
+			cardKey:    d.cardKey,
+		})
+		verified = append(verified, *d)
+	}
+	return verified
+}
+
+func depositOutcome(d *PendingDeposit, err error) Outcome {
+	if err != nil || d.Status != CREDITED {
+		return FAILURE
+	}
+	return SUCCESS
+}
+
+func (atm *AtmMachine) acceptDeposit(cash *CashDeposit) (*PendingDeposit, error) {
+	if cash == nil || len(cash.Notes) == 0 {
+		return nil, ErrNoNotes
+	}
+	if cash.Declared <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	for _, n := range cash.Notes {
+		if !atm.cash.Accepts(n.Denomination) {
+			return nil, fmt.Errorf("%w: %d", ErrUnknownDenomination, n.Denomination)
+		}
+	}
+
+	now := atm.now()
+	d := atm.depositBin.add(&PendingDeposit{
+		MachineId:   atm.id,
+		AccountId:   atm.account.id,
+		CardNumber:  maskCardNumber(atm.card.number),
+		Declared:    cash.Declared,
+		Notes:       append([]Note(nil), cash.Notes...),
+		Status:      PENDING,
+		DepositedAt: now,
+		ReleaseAt:   now.Add(atm.depositHold),
+		cardKey:     cardKey(atm.card.number),
+	})
+
+	if atm.depositHold <= 0 {
+		atm.verifyDeposits()
+	}
+	return d, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+type Fixture struct {
+	Machine  MachineFixture   `json:"machine"`
+	Accounts []AccountFixture `json:"accounts"`
+}
+
+type MachineFixture struct {
+	Id       string         `json:"id"`
+	Location string         `json:"location"`
+	Cash     map[string]int `json:"cash"` // denomination -> note count
+}
+
+type AccountFixture struct {
+	UserId              string `json:"userId"`
+	Pin                 string `json:"pin"`
+	Balance             int    `json:"balance"`
+	DailyLimit          int    `json:"dailyLimit"`
+	PerTransactionLimit int    `json:"perTransactionLimit"`
+	Timezone            string `json:"timezone"`
+}
+
+func LoadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Fixture{}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("parse fixture %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// Seed creates every fixture account in srv and issues one card per account.
+func (f *Fixture) Seed(srv *AccountService) ([]*Card, error) {
+	cards := make([]*Card, 0, len(f.Accounts))
+	for _, a := range f.Accounts {
+		account, err := srv.CreateAccount(a.UserId, a.Pin, a.Balance)
+		if err != nil {
+			return nil, fmt.Errorf("account for %s: %w", a.UserId, err)
+		}
+
+		if a.DailyLimit > 0 || a.PerTransactionLimit > 0 {
+			srv.SetWithdrawalLimits(account, WithdrawalLimits{
+				Daily:          a.DailyLimit,
+				PerTransaction: a.PerTransactionLimit,
+			})
+		}
+		if a.Timezone != "" {
+			loc, err := time.LoadLocation(a.Timezone)
+			if err != nil {
+				return nil, err
+			}
+			srv.SetTimezone(account, loc)
+		}
+
+		card, err := srv.IssueCard(account.id)
+		if err != nil {
+			return nil, err
+		}
+		cards = append(cards, card)
+	}
+	return cards, nil
+}
+
+func (f *Fixture) LoadCash(c *CashCassette) error {
+	for denomination, count := range f.Machine.Cash {
+		d, err := strconv.Atoi(denomination)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrUnknownDenomination, denomination)
+		}
+		if err := c.Refill(d, count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
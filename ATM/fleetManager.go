@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrOutOfService   = errors.New("ATM out of service")
+	ErrMachineBusy    = errors.New("ATM has a customer session in progress")
+	ErrMachineExists  = errors.New("ATM already registered")
+	ErrMachineUnknown = errors.New("ATM not registered")
+)
+
+// MaintenanceState rejects every customer operation until a technician
+// brings the machine back into service.
+type MaintenanceState struct{}
+
+func (m *MaintenanceState) insertCard(atm *AtmMachine, c *Card) error {
+	return ErrOutOfService
+}
+func (m *MaintenanceState) enterPin(atm *AtmMachine, pin string) error {
+	return ErrOutOfService
+}
+func (m *MaintenanceState) checkBalance(atm *AtmMachine) (*AtmResponse, error) {
+	return nil, ErrOutOfService
+}
+func (m *MaintenanceState) withdraw(atm *AtmMachine, amt int) (*AtmResponse, error) {
+	return nil, ErrOutOfService
+}
+func (m *MaintenanceState) deposit(atm *AtmMachine, cash *CashDeposit) (*AtmResponse, error) {
+	return nil, ErrOutOfService
+}
+func (m *MaintenanceState) transfer(atm *AtmMachine, toAccountId string, amt int) (*AtmResponse, error) {
+	return nil, ErrOutOfService
+}
+func (m *MaintenanceState) miniStatement(atm *AtmMachine, n int) (*AtmResponse, error) {
+	return nil, ErrOutOfService
+}
+func (m *MaintenanceState) changePin(atm *AtmMachine, oldPin, newPin string) error {
+	return ErrOutOfService
+}
+func (m *MaintenanceState) exitAtm(atm *AtmMachine) error {
+	return ErrOutOfService
+}
+
+func (atm *AtmMachine) EnterMaintenance() error {
+	atm.mu.Lock()
+	defer atm.mu.Unlock()
+
+	switch atm.state.(type) {
+	case *MaintenanceState:
+		return nil
+	case *IdleState:
+		atm.SetState(&MaintenanceState{})
+		return nil
+	default:
+		return ErrMachineBusy
+	}
+}
+
+func (atm *AtmMachine) ExitMaintenance() error {
+	atm.mu.Lock()
+	defer atm.mu.Unlock()
+
+	if _, ok := atm.state.(*MaintenanceState); !ok {
+		return fmt.Errorf("ATM not in maintenance")
+	}
+	atm.SetState(&IdleState{})
+	atm.touch()
+	return nil
+}
+
+type AtmStatus struct {
+	Id            string
+	Location      string
+	State         string
+	Cash          map[int]int // denomination -> note count
+	CashTotal     int
+	RetainedCards int
+}
+
+// FleetManager keeps track of every machine in the network. Machines it
+// registers share one journal.
+type FleetManager struct {
+	machines map[string]*AtmMachine
+	journal  *Journal
+	mu       sync.RWMutex
+}
+
+func NewFleetManager() *FleetManager {
+	return &FleetManager{
+		machines: make(map[string]*AtmMachine),
+		journal:  NewJournal(),
+	}
+}
+
+func (f *FleetManager) Register(id, location string, srv *AccountService) (*AtmMachine, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.machines[id]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrMachineExists, id)
+	}
+
+	atm := GetAtm(srv)
+	atm.id = id
+	atm.location = location
+	atm.journal = f.journal
+
+	f.machines[id] = atm
+	return atm, nil
+}
+
+func (f *FleetManager) Get(id string) (*AtmMachine, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	atm, ok := f.machines[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrMachineUnknown, id)
+	}
+	return atm, nil
+}
+
+func (f *FleetManager) Journal() *Journal {
+	return f.journal
+}
+
+// Status reports every machine ordered by id.
+func (f *FleetManager) Status() []AtmStatus {
+	f.mu.RLock()
+	machines := make([]*AtmMachine, 0, len(f.machines))
+	for _, atm := range f.machines {
+		machines = append(machines, atm)
+	}
+	f.mu.RUnlock()
+
+	sort.Slice(machines, func(i, j int) bool { return machines[i].id < machines[j].id })
+
+	statuses := make([]AtmStatus, 0, len(machines))
+	for _, atm := range machines {
+		statuses = append(statuses, AtmStatus{
+			Id:            atm.id,
+			Location:      atm.location,
+			State:         atm.StateName(),
+			Cash:          atm.cash.Counts(),
+			CashTotal:     atm.cash.Total(),
+			RetainedCards: len(atm.RetainedCards()),
+		})
+	}
+	return statuses
+}
+
+// LowCash returns the machines holding less than threshold in total.
+func (f *FleetManager) LowCash(threshold int) []AtmStatus {
+	low := make([]AtmStatus, 0)
+	for _, s := range f.Status() {
+		if s.CashTotal < threshold {
+			low = append(low, s)
+		}
+	}
+	return low
+}
+
+func (f *FleetManager) StartMaintenance(id string) error {
+	atm, err := f.Get(id)
+	if err != nil {
+		return err
+	}
+	return atm.EnterMaintenance()
+}
+
+func (f *FleetManager) EndMaintenance(id string) error {
+	atm, err := f.Get(id)
+	if err != nil {
+		return err
+	}
+	return atm.ExitMaintenance()
+}
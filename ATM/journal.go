@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+type JournalEvent string
+
+const (
+	CARD_INSERT       JournalEvent = "CARD_INSERT"
+	PIN_CHANGE        JournalEvent = "PIN_CHANGE"
+	PIN_ENTRY         JournalEvent = "PIN_ENTRY"
+	BALANCE_INQUIRY   JournalEvent = "BALANCE_INQUIRY"
+	WITHDRAWAL        JournalEvent = "WITHDRAWAL"
+	CASH_DEPOSIT      JournalEvent = "CASH_DEPOSIT"
+	DEPOSIT_VERIFIED  JournalEvent = "DEPOSIT_VERIFIED"
+	FUNDS_TRANSFER    JournalEvent = "FUNDS_TRANSFER"
+	STATEMENT_INQUIRY JournalEvent = "STATEMENT_INQUIRY"
+	CARD_EJECT        JournalEvent = "CARD_EJECT"
+	CARD_RETAINED     JournalEvent = "CARD_RETAINED"
+	SESSION_TIMEOUT   JournalEvent = "SESSION_TIMEOUT"
+)
+
+type Outcome string
+
+const (
+	SUCCESS Outcome = "SUCCESS"
+	FAILURE Outcome = "FAILURE"
+)
+
+type JournalEntry struct {
+	MachineId  string
+	CardNumber string // masked, e.g. ************0001
+	Event      JournalEvent
+	Outcome    Outcome
+	Amount     int
+	Detail     string
+	Timestamp  time.Time
+
+	cardKey string // hash of the full card number, used for lookups
+}
+
+// Journal is an append-only audit log. It can be shared by many machines.
+type Journal struct {
+	entries []JournalEntry
+	mu      sync.RWMutex
+}
+
+func NewJournal() *Journal {
+	return &Journal{
+		entries: make([]JournalEntry, 0),
+	}
+}
+
+func (j *Journal) Append(e JournalEntry) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries = append(j.entries, e)
+}
+
+// Query returns the entries for cardNumber with from <= Timestamp < to. A
+// zero from or to leaves that end of the range open; an empty cardNumber
+// matches every card.
+func (j *Journal) Query(cardNumber string, from, to time.Time) []JournalEntry {
+	key := ""
+	if cardNumber != "" {
+		key = cardKey(cardNumber)
+	}
+
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	result := make([]JournalEntry, 0)
+	for _, e := range j.entries {
+		if key != "" && e.cardKey != key {
+			continue
+		}
+		if !from.IsZero() && e.Timestamp.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !e.Timestamp.Before(to) {
+			continue
+		}
+		result = append(result, e)
+	}
+	return result
+}
+
+func cardKey(number string) string {
+	sum := sha256.Sum256([]byte(number))
+	return hex.EncodeToString(sum[:])
+}
+
+func maskCardNumber(number string) string {
+	if len(number) <= 4 {
+		return number
+	}
+	return strings.Repeat("*", len(number)-4) + number[len(number)-4:]
+}
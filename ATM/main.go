@@ -1,6 +1,14 @@
 package main
 
-import "fmt"
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
 
 /*
 Design aTM
@@ -25,58 +33,84 @@ Design aTM
 			- eject
 */
 
-type User struct {
-	id string
-}
+// Run the terminal simulator from this directory:
+//
+//	go run *.go -fixture fixtures/accounts.json
+//
+// Piping a script into stdin replays a session, e.g. printf '1\n1\n1\n4729\n1\n4\n0\n'.
+func main() {
+	fixturePath := flag.String("fixture", "fixtures/accounts.json", "JSON file with accounts and machine cash")
+	flag.Parse()
 
-type Card struct {
-	number string
-	userId string
-}
+	fixture, err := LoadFixture(*fixturePath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	srv := NewAccountService()
+	cards, err := fixture.Seed(srv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
-type Account struct {
-	id     string
-	userId string
-	pin    uint32
+	fleet := NewFleetManager()
+	atm, err := fleet.Register(fixture.Machine.Id, fixture.Machine.Location, srv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := fixture.LoadCash(atm.cash); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	NewSimulator(atm, cards, os.Stdin, os.Stdout).Run()
 }
 
-type AccountService struct {
-	userAccounts map[string]*Account // userId -> account
+type User struct {
+	id string
 }
 
-func NewAccountService() *AccountService {
-	return &AccountService{
-		userAccounts: make(map[string]*Account),
-	}
+type Card struct {
+	number    string
+	userId    string
+	accountId string // the account this card operates on
 }
 
-func (s *AccountService) CreateAccount(userId string, pin uint32) *Account {
-	// check if user has already an account
-	newAccount := &Account{
-		id:     "account" + userId,
-		userId: userId,
-		pin:    pin,
-	}
+type Operation string
 
-	s.userAccounts[userId] = newAccount
+const (
+	BALANCE        Operation = "BALANCE"
+	WITHDRAW       Operation = "WITHDRAW"
+	DEPOSIT        Operation = "DEPOSIT"
+	TRANSFER       Operation = "TRANSFER"
+	MINI_STATEMENT Operation = "MINI_STATEMENT"
+)
 
-	return newAccount
-}
+// AtmResponse is what the machine shows the user after an account operation.
+type AtmResponse struct {
+	Operation Operation
+	Amount    int
+	Balance   int
+	Notes     map[int]int     // denomination -> count handed out
+	ToAccount string          // set for transfers
+	Deposit   *PendingDeposit // set for deposits
+	Receipt   *Receipt        // set for withdrawals, deposits and transfers
 
-func (s *AccountService) GetAccount(userId string, pin uint32) (*Account, error) {
-	// check if user has an account
-	if _, ok := s.userAccounts[userId]; !ok {
-		return nil, fmt.Errorf("Account does not exist")
-	}
-	return s.userAccounts[userId], nil
+	Transactions []AccountTransaction // set for mini statements
 }
 
 type AtmState interface {
 	insertCard(atm *AtmMachine, c *Card) error
-	enterPin(atm *AtmMachine, pin uint32) error
-	checkBalance(atm *AtmMachine) error
-	withdraw(atm *AtmMachine, amt int) error
-	deposit(atm *AtmMachine, amt int) error
+	enterPin(atm *AtmMachine, pin string) error
+	checkBalance(atm *AtmMachine) (*AtmResponse, error)
+	withdraw(atm *AtmMachine, amt int) (*AtmResponse, error)
+	deposit(atm *AtmMachine, cash *CashDeposit) (*AtmResponse, error)
+	transfer(atm *AtmMachine, toAccountId string, amt int) (*AtmResponse, error)
+	miniStatement(atm *AtmMachine, n int) (*AtmResponse, error)
+	changePin(atm *AtmMachine, oldPin, newPin string) error
 	exitAtm(atm *AtmMachine) error
 }
 
@@ -85,48 +119,402 @@ type CardInsertedState struct{}
 type AuthenticatedState struct{}
 
 func (i *IdleState) insertCard(atm *AtmMachine, c *Card) error {
+	if atm.presentedCard != nil {
+		return fmt.Errorf("Take your card first")
+	}
+	if atm.accService.IsBlocked(c) {
+		atm.retainedCards = append(atm.retainedCards, c)
+		atm.record(CARD_RETAINED, c, 0, ErrCardBlocked)
+		return ErrCardBlocked
+	}
 	atm.card = c
 	atm.SetState(&CardInsertedState{})
 	return nil
 }
-func (i *IdleState) enterPin(atm *AtmMachine, pin uint32) error {
+func (i *IdleState) enterPin(atm *AtmMachine, pin string) error {
+	return fmt.Errorf("Card not inserted")
+}
+func (i *IdleState) checkBalance(atm *AtmMachine) (*AtmResponse, error) {
+	return nil, fmt.Errorf("Card not inserted")
+}
+func (i *IdleState) withdraw(atm *AtmMachine, amt int) (*AtmResponse, error) {
+	return nil, fmt.Errorf("Card not inserted")
+}
+func (i *IdleState) deposit(atm *AtmMachine, cash *CashDeposit) (*AtmResponse, error) {
+	return nil, fmt.Errorf("Card not inserted")
+}
+func (i *IdleState) transfer(atm *AtmMachine, toAccountId string, amt int) (*AtmResponse, error) {
+	return nil, fmt.Errorf("Card not inserted")
+}
+func (i *IdleState) miniStatement(atm *AtmMachine, n int) (*AtmResponse, error) {
+	return nil, fmt.Errorf("Card not inserted")
+}
+func (i *IdleState) changePin(atm *AtmMachine, oldPin, newPin string) error {
 	return fmt.Errorf("Card not inserted")
 }
-func (i *IdleState) checkBalance(atm *AtmMachine) error      { return fmt.Errorf("Card not inserted") }
-func (i *IdleState) withdraw(atm *AtmMachine, amt int) error { return fmt.Errorf("Card not inserted") }
-func (i *IdleState) deposit(atm *AtmMachine, amt int) error  { return fmt.Errorf("Card not inserted") }
-func (i *IdleState) exitAtm(atm *AtmMachine) error           { return fmt.Errorf("Card not inserted") }
+func (i *IdleState) exitAtm(atm *AtmMachine) error { return fmt.Errorf("Card not inserted") }
 
 func (i *CardInsertedState) insertCard(atm *AtmMachine, c *Card) error {
 	return fmt.Errorf("Card already inserted")
 }
-func (i *CardInsertedState) enterPin(atm *AtmMachine, pin uint32) error {
-	//validate pin
+func (i *CardInsertedState) enterPin(atm *AtmMachine, pin string) error {
+	account, err := atm.accService.VerifyPin(atm.card, pin)
+	if errors.Is(err, ErrCardBlocked) {
+		atm.retainCard()
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	atm.account = account
+	atm.SetState(&AuthenticatedState{})
 	return nil
 }
-func (i *CardInsertedState) checkBalance(atm *AtmMachine) error {
-	return fmt.Errorf("PIN not entered")
+func (i *CardInsertedState) checkBalance(atm *AtmMachine) (*AtmResponse, error) {
+	return nil, fmt.Errorf("PIN not entered")
 }
-func (i *CardInsertedState) withdraw(atm *AtmMachine, amt int) error {
-	return fmt.Errorf("PIN not entered")
+func (i *CardInsertedState) withdraw(atm *AtmMachine, amt int) (*AtmResponse, error) {
+	return nil, fmt.Errorf("PIN not entered")
+}
+func (i *CardInsertedState) deposit(atm *AtmMachine, cash *CashDeposit) (*AtmResponse, error) {
+	return nil, fmt.Errorf("PIN not entered")
 }
-func (i *CardInsertedState) deposit(atm *AtmMachine, amt int) error {
+func (i *CardInsertedState) transfer(atm *AtmMachine, toAccountId string, amt int) (*AtmResponse, error) {
+	return nil, fmt.Errorf("PIN not entered")
+}
+func (i *CardInsertedState) miniStatement(atm *AtmMachine, n int) (*AtmResponse, error) {
+	return nil, fmt.Errorf("PIN not entered")
+}
+func (i *CardInsertedState) changePin(atm *AtmMachine, oldPin, newPin string) error {
 	return fmt.Errorf("PIN not entered")
 }
 func (i *CardInsertedState) exitAtm(atm *AtmMachine) error {
+	atm.ejectCard()
+	return nil
+}
+
+func (i *AuthenticatedState) insertCard(atm *AtmMachine, c *Card) error {
+	return fmt.Errorf("Card already inserted")
+}
+func (i *AuthenticatedState) enterPin(atm *AtmMachine, pin string) error {
+	return fmt.Errorf("PIN already verified")
+}
+func (i *AuthenticatedState) checkBalance(atm *AtmMachine) (*AtmResponse, error) {
+	return &AtmResponse{
+		Operation: BALANCE,
+		Balance:   atm.accService.Balance(atm.account),
+	}, nil
+}
+func (i *AuthenticatedState) withdraw(atm *AtmMachine, amt int) (*AtmResponse, error) {
+	// reserve the notes first so the account is never debited for cash the
+	// machine cannot pay out
+	notes, err := atm.cash.Reserve(amt)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, err := atm.accService.Withdraw(atm.account, amt)
+	if err != nil {
+		atm.cash.Restock(notes)
+		return nil, err
+	}
+	atm.cash.Commit(notes)
+	return &AtmResponse{
+		Operation: WITHDRAW,
+		Amount:    amt,
+		Balance:   balance,
+		Notes:     notes,
+	}, nil
+}
+func (i *AuthenticatedState) deposit(atm *AtmMachine, cash *CashDeposit) (*AtmResponse, error) {
+	d, err := atm.acceptDeposit(cash)
+	if err != nil {
+		return nil, err
+	}
+
+	// d is shared with the bin; hand back a copy
+	deposit := *d
+	return &AtmResponse{
+		Operation: DEPOSIT,
+		Amount:    cash.Declared,
+		Balance:   atm.accService.Balance(atm.account),
+		Deposit:   &deposit,
+	}, nil
+}
+func (i *AuthenticatedState) transfer(atm *AtmMachine, toAccountId string, amt int) (*AtmResponse, error) {
+	balance, err := atm.accService.Transfer(atm.account, toAccountId, amt)
+	if err != nil {
+		return nil, err
+	}
+	return &AtmResponse{
+		Operation: TRANSFER,
+		Amount:    amt,
+		Balance:   balance,
+		ToAccount: toAccountId,
+	}, nil
+}
+func (i *AuthenticatedState) miniStatement(atm *AtmMachine, n int) (*AtmResponse, error) {
+	return &AtmResponse{
+		Operation:    MINI_STATEMENT,
+		Balance:      atm.accService.Balance(atm.account),
+		Transactions: atm.accService.MiniStatement(atm.account, n),
+	}, nil
+}
+func (i *AuthenticatedState) changePin(atm *AtmMachine, oldPin, newPin string) error {
+	err := atm.accService.ChangePin(atm.card, oldPin, newPin)
+	if errors.Is(err, ErrCardBlocked) {
+		atm.retainCard()
+	}
+	return err
+}
+func (i *AuthenticatedState) exitAtm(atm *AtmMachine) error {
+	atm.ejectCard()
 	return nil
 }
 
 type AtmMachine struct {
-	state      AtmState
-	accService *AccountService
-	card       *Card
+	id            string
+	location      string
+	state         AtmState
+	accService    *AccountService
+	card          *Card
+	account       *Account
+	retainedCards []*Card
+	cash          *CashCassette
+	journal       *Journal
+	clock         Clock
+	receiptSeq    int
+	depositBin    *DepositBin
+	depositHold   time.Duration // zero verifies deposits immediately
+
+	timeouts      SessionTimeouts
+	lastActivity  time.Time
+	presentedCard *Card // ejected but not yet taken by the user
+	presentedAt   time.Time
+	mu            sync.Mutex
 }
 
 func GetAtm(srv *AccountService) *AtmMachine {
-	return &AtmMachine{}
+	return &AtmMachine{
+		id:           "ATM",
+		state:        &IdleState{},
+		accService:   srv,
+		cash:         NewCashCassette(),
+		journal:      NewJournal(),
+		depositBin:   NewDepositBin(),
+		clock:        realClock{},
+		timeouts:     DefaultSessionTimeouts,
+		lastActivity: time.Now(),
+	}
 }
 
 func (atm *AtmMachine) SetState(s AtmState) {
 	atm.state = s
 }
+
+func (atm *AtmMachine) InsertCard(c *Card) error {
+	atm.mu.Lock()
+	defer atm.mu.Unlock()
+	atm.touch()
+
+	err := atm.state.insertCard(atm, c)
+	atm.record(CARD_INSERT, c, 0, err)
+	return err
+}
+
+func (atm *AtmMachine) EnterPin(pin string) error {
+	atm.mu.Lock()
+	defer atm.mu.Unlock()
+	atm.touch()
+
+	card := atm.card
+	err := atm.state.enterPin(atm, pin)
+	atm.record(PIN_ENTRY, card, 0, err)
+	return err
+}
+
+func (atm *AtmMachine) CheckBalance() (*AtmResponse, error) {
+	atm.mu.Lock()
+	defer atm.mu.Unlock()
+	atm.touch()
+
+	resp, err := atm.state.checkBalance(atm)
+	atm.record(BALANCE_INQUIRY, atm.card, 0, err)
+	return resp, err
+}
+
+func (atm *AtmMachine) Withdraw(amt int) (*AtmResponse, error) {
+	atm.mu.Lock()
+	defer atm.mu.Unlock()
+	atm.touch()
+
+	resp, err := atm.state.withdraw(atm, amt)
+	atm.record(WITHDRAWAL, atm.card, amt, err)
+	if err == nil {
+		resp.Receipt = atm.printReceipt(resp)
+	}
+	return resp, err
+}
+
+// Deposit takes cash into the deposit bin. The account is credited once the
+// deposit is verified after the machine's hold period.
+func (atm *AtmMachine) Deposit(cash *CashDeposit) (*AtmResponse, error) {
+	atm.mu.Lock()
+	defer atm.mu.Unlock()
+	atm.touch()
+
+	declared := 0
+	if cash != nil {
+		declared = cash.Declared
+	}
+	resp, err := atm.state.deposit(atm, cash)
+	atm.record(CASH_DEPOSIT, atm.card, declared, err)
+	if err == nil {
+		resp.Receipt = atm.printReceipt(resp)
+	}
+	return resp, err
+}
+
+func (atm *AtmMachine) Transfer(toAccountId string, amt int) (*AtmResponse, error) {
+	atm.mu.Lock()
+	defer atm.mu.Unlock()
+	atm.touch()
+
+	resp, err := atm.state.transfer(atm, toAccountId, amt)
+	atm.record(FUNDS_TRANSFER, atm.card, amt, err)
+	if err == nil {
+		resp.Receipt = atm.printReceipt(resp)
+	}
+	return resp, err
+}
+
+// MiniStatement returns the last n transactions of the card's account.
+func (atm *AtmMachine) MiniStatement(n int) (*AtmResponse, error) {
+	atm.mu.Lock()
+	defer atm.mu.Unlock()
+	atm.touch()
+
+	resp, err := atm.state.miniStatement(atm, n)
+	atm.record(STATEMENT_INQUIRY, atm.card, 0, err)
+	return resp, err
+}
+
+func (atm *AtmMachine) ChangePin(oldPin, newPin string) error {
+	atm.mu.Lock()
+	defer atm.mu.Unlock()
+	atm.touch()
+
+	card := atm.card
+	err := atm.state.changePin(atm, oldPin, newPin)
+	atm.record(PIN_CHANGE, card, 0, err)
+	return err
+}
+
+func (atm *AtmMachine) Exit() error {
+	atm.mu.Lock()
+	defer atm.mu.Unlock()
+	atm.touch()
+
+	card := atm.card
+	err := atm.state.exitAtm(atm)
+	atm.record(CARD_EJECT, card, 0, err)
+	return err
+}
+
+func (atm *AtmMachine) Cash() *CashCassette { return atm.cash }
+func (atm *AtmMachine) Journal() *Journal   { return atm.journal }
+
+func (atm *AtmMachine) RetainedCards() []*Card {
+	atm.mu.Lock()
+	defer atm.mu.Unlock()
+	return append([]*Card(nil), atm.retainedCards...)
+}
+
+func (atm *AtmMachine) State() AtmState {
+	atm.mu.Lock()
+	defer atm.mu.Unlock()
+	return atm.state
+}
+
+func (atm *AtmMachine) StateName() string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", atm.State()), "*main.")
+}
+
+func (atm *AtmMachine) HasCard() bool {
+	atm.mu.Lock()
+	defer atm.mu.Unlock()
+	return atm.card != nil
+}
+
+// ejectCard ends the session and pushes the card out of the slot, where it
+// waits for TakeCard.
+func (atm *AtmMachine) ejectCard() {
+	atm.presentedCard = atm.card
+	atm.presentedAt = atm.now()
+	atm.endSession()
+}
+
+// retainCard keeps the inserted card inside the machine instead of ejecting it.
+func (atm *AtmMachine) retainCard() {
+	atm.retainedCards = append(atm.retainedCards, atm.card)
+	atm.record(CARD_RETAINED, atm.card, 0, nil)
+	atm.endSession()
+}
+
+func (atm *AtmMachine) endSession() {
+	atm.card = nil
+	atm.account = nil
+	atm.SetState(&IdleState{})
+}
+
+func (atm *AtmMachine) now() time.Time {
+	if atm.clock == nil {
+		return time.Now()
+	}
+	return atm.clock.Now()
+}
+
+func (atm *AtmMachine) record(event JournalEvent, c *Card, amt int, err error) {
+	if atm.journal == nil {
+		return
+	}
+
+	entry := JournalEntry{
+		MachineId: atm.id,
+		Event:     event,
+		Outcome:   SUCCESS,
+		Amount:    amt,
+		Timestamp: atm.now(),
+	}
+	if c != nil {
+		entry.CardNumber = maskCardNumber(c.number)
+		entry.cardKey = cardKey(c.number)
+	}
+	if err != nil {
+		entry.Outcome = FAILURE
+		entry.Detail = err.Error()
+	}
+	atm.journal.Append(entry)
+}
+
+func (atm *AtmMachine) printReceipt(resp *AtmResponse) *Receipt {
+	atm.receiptSeq++
+	receipt := &Receipt{
+		ReferenceId: fmt.Sprintf("%s-%06d", atm.id, atm.receiptSeq),
+		MachineId:   atm.id,
+		CardNumber:  maskCardNumber(atm.card.number),
+		Operation:   resp.Operation,
+		Amount:      resp.Amount,
+		Balance:     resp.Balance,
+		Notes:       resp.Notes,
+		ToAccount:   resp.ToAccount,
+		Timestamp:   atm.now(),
+	}
+	if resp.Deposit != nil {
+		receipt.DepositId = resp.Deposit.Id
+		receipt.DepositStatus = resp.Deposit.Status
+		receipt.Counterfeit = len(resp.Deposit.Counterfeit)
+	}
+	return receipt
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPin = "4729"
+
+type atmFixture struct {
+	atm  *AtmMachine
+	card *Card
+}
+
+func newAtmFixture(t *testing.T) *atmFixture {
+	t.Helper()
+
+	srv := NewAccountService()
+	account, err := srv.CreateAccount("user1", testPin, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	card, err := srv.IssueCard(account.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &atmFixture{atm: GetAtm(srv), card: card}
+}
+
+type atmStep struct {
+	name      string
+	do        func(f *atmFixture) error
+	wantErr   error  // matched with errors.Is
+	wantMsg   string // substring of the error message
+	wantState string
+	check     func(t *testing.T, f *atmFixture)
+}
+
+func insertCard(f *atmFixture) error { return f.atm.InsertCard(f.card) }
+func exitAtm(f *atmFixture) error    { return f.atm.Exit() }
+
+func enterPin(pin string) func(f *atmFixture) error {
+	return func(f *atmFixture) error { return f.atm.EnterPin(pin) }
+}
+
+func takeCard(f *atmFixture) error {
+	_, err := f.atm.TakeCard()
+	return err
+}
+
+func retained(n int) func(t *testing.T, f *atmFixture) {
+	return func(t *testing.T, f *atmFixture) {
+		cards := f.atm.RetainedCards()
+		if len(cards) != n {
+			t.Fatalf("retained %d cards, want %d", len(cards), n)
+		}
+		if n > 0 && cards[n-1] != f.card {
+			t.Errorf("retained card %s, want %s", cards[n-1].number, f.card.number)
+		}
+		if f.atm.HasCard() {
+			t.Error("retained card is still in the reader")
+		}
+		if _, err := f.atm.TakeCard(); err == nil {
+			t.Error("retained card was presented to the user")
+		}
+
+		journaled := 0
+		for _, e := range f.atm.Journal().Query(f.card.number, time.Time{}, time.Time{}) {
+			if e.Event == CARD_RETAINED {
+				journaled++
+			}
+		}
+		if journaled != n {
+			t.Errorf("journal has %d CARD_RETAINED entries, want %d", journaled, n)
+		}
+	}
+}
+
+func cardPresented(t *testing.T, f *atmFixture) {
+	card, err := f.atm.TakeCard()
+	if err != nil {
+		t.Fatalf("TakeCard: %v", err)
+	}
+	if card != f.card {
+		t.Errorf("ejected card %s, want %s", card.number, f.card.number)
+	}
+	// put it back so later steps see the same slot state
+	f.atm.presentedCard = card
+}
+
+func TestAtmTransitions(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []atmStep
+	}{
+		{
+			name: "idle to card inserted",
+			steps: []atmStep{
+				{name: "insert", do: insertCard, wantState: "CardInsertedState"},
+			},
+		},
+		{
+			name: "wrong PIN reports remaining attempts",
+			steps: []atmStep{
+				{name: "insert", do: insertCard, wantState: "CardInsertedState"},
+				{name: "wrong 1", do: enterPin("0000"), wantErr: ErrIncorrectPin, wantMsg: "2 attempts remaining", wantState: "CardInsertedState"},
+				{name: "wrong 2", do: enterPin("1111"), wantErr: ErrIncorrectPin, wantMsg: "1 attempts remaining", wantState: "CardInsertedState"},
+			},
+		},
+		{
+			name: "third wrong PIN blocks and retains the card",
+			steps: []atmStep{
+				{name: "insert", do: insertCard, wantState: "CardInsertedState"},
+				{name: "wrong 1", do: enterPin("0000"), wantErr: ErrIncorrectPin, wantState: "CardInsertedState"},
+				{name: "wrong 2", do: enterPin("0000"), wantErr: ErrIncorrectPin, wantState: "CardInsertedState"},
+				{name: "wrong 3", do: enterPin("0000"), wantErr: ErrCardBlocked, wantState: "IdleState", check: retained(1)},
+			},
+		},
+		{
+			name: "blocked card is retained when inserted again",
+			steps: []atmStep{
+				{name: "insert", do: insertCard, wantState: "CardInsertedState"},
+				{name: "wrong 1", do: enterPin("0000"), wantErr: ErrIncorrectPin, wantState: "CardInsertedState"},
+				{name: "wrong 2", do: enterPin("0000"), wantErr: ErrIncorrectPin, wantState: "CardInsertedState"},
+				{name: "wrong 3", do: enterPin("0000"), wantErr: ErrCardBlocked, wantState: "IdleState", check: retained(1)},
+				{name: "reinsert", do: insertCard, wantErr: ErrCardBlocked, wantState: "IdleState", check: retained(2)},
+			},
+		},
+		{
+			name: "correct PIN authenticates and resets failures",
+			steps: []atmStep{
+				{name: "insert", do: insertCard, wantState: "CardInsertedState"},
+				{name: "wrong 1", do: enterPin("0000"), wantErr: ErrIncorrectPin, wantState: "CardInsertedState"},
+				{name: "wrong 2", do: enterPin("0000"), wantErr: ErrIncorrectPin, wantState: "CardInsertedState"},
+				{name: "correct", do: enterPin(testPin), wantState: "AuthenticatedState"},
+				{name: "exit", do: exitAtm, wantState: "IdleState"},
+				{name: "take card", do: takeCard, wantState: "IdleState"},
+				{name: "reinsert", do: insertCard, wantState: "CardInsertedState"},
+				{name: "wrong again", do: enterPin("0000"), wantErr: ErrIncorrectPin, wantMsg: "2 attempts remaining", wantState: "CardInsertedState"},
+			},
+		},
+		{
+			name: "exit while idle",
+			steps: []atmStep{
+				{name: "exit", do: exitAtm, wantMsg: "Card not inserted", wantState: "IdleState"},
+			},
+		},
+		{
+			name: "eject from card inserted",
+			steps: []atmStep{
+				{name: "insert", do: insertCard, wantState: "CardInsertedState"},
+				{name: "exit", do: exitAtm, wantState: "IdleState", check: cardPresented},
+				{name: "insert before taking card", do: insertCard, wantMsg: "Take your card first", wantState: "IdleState"},
+			},
+		},
+		{
+			name: "eject from authenticated",
+			steps: []atmStep{
+				{name: "insert", do: insertCard, wantState: "CardInsertedState"},
+				{name: "pin", do: enterPin(testPin), wantState: "AuthenticatedState"},
+				{name: "exit", do: exitAtm, wantState: "IdleState", check: cardPresented},
+				{name: "session closed", do: func(f *atmFixture) error {
+					_, err := f.atm.CheckBalance()
+					return err
+				}, wantMsg: "Card not inserted", wantState: "IdleState"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newAtmFixture(t)
+			for _, step := range tt.steps {
+				err := step.do(f)
+
+				switch {
+				case step.wantErr == nil && step.wantMsg == "" && err != nil:
+					t.Fatalf("%s: unexpected error %v", step.name, err)
+				case step.wantErr != nil && !errors.Is(err, step.wantErr):
+					t.Fatalf("%s: err = %v, want %v", step.name, err, step.wantErr)
+				case step.wantMsg != "" && (err == nil || !strings.Contains(err.Error(), step.wantMsg)):
+					t.Fatalf("%s: err = %v, want message containing %q", step.name, err, step.wantMsg)
+				}
+				if got := f.atm.StateName(); got != step.wantState {
+					t.Fatalf("%s: state = %s, want %s", step.name, got, step.wantState)
+				}
+				if step.check != nil {
+					step.check(t, f)
+				}
+			}
+		})
+	}
+}
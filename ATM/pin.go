@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+)
+
+const (
+	pinSaltSize       = 16
+	pinHashSize       = 32
+	pinHashIterations = 100000
+)
+
+var (
+	ErrWeakPin = errors.New("PIN does not meet policy")
+	ErrSamePin = errors.New("New PIN must differ from the old PIN")
+)
+
+// pinHash stores a PIN as a salted PBKDF2-SHA256 hash. The PIN itself is
+// never kept.
+type pinHash struct {
+	salt []byte
+	hash []byte
+}
+
+func newPinHash(pin string) (pinHash, error) {
+	salt := make([]byte, pinSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return pinHash{}, err
+	}
+	hash, err := derivePin(pin, salt)
+	if err != nil {
+		return pinHash{}, err
+	}
+	return pinHash{salt: salt, hash: hash}, nil
+}
+
+// matches compares in constant time so response timing does not reveal how
+// much of the PIN was right.
+func (p pinHash) matches(pin string) bool {
+	hash, err := derivePin(pin, p.salt)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(hash, p.hash) == 1
+}
+
+func derivePin(pin string, salt []byte) ([]byte, error) {
+	return pbkdf2.Key(sha256.New, pin, salt, pinHashIterations, pinHashSize)
+}
+
+type PinPolicy struct {
+	MinLength int
+	MaxLength int
+}
+
+var DefaultPinPolicy = PinPolicy{
+	MinLength: 4,
+	MaxLength: 6,
+}
+
+// Validate rejects PINs that are not all digits, have the wrong length, repeat
+// one digit (1111) or run straight up or down (1234, 9876).
+func (p PinPolicy) Validate(pin string) error {
+	if len(pin) < p.MinLength || len(pin) > p.MaxLength {
+		return fmt.Errorf("%w: must be %d to %d digits", ErrWeakPin, p.MinLength, p.MaxLength)
+	}
+	for _, r := range pin {
+		if r < '0' || r > '9' {
+			return fmt.Errorf("%w: digits only", ErrWeakPin)
+		}
+	}
+
+	repeated, ascending, descending := true, true, true
+	for i := 1; i < len(pin); i++ {
+		diff := int(pin[i]) - int(pin[i-1])
+		repeated = repeated && diff == 0
+		ascending = ascending && diff == 1
+		descending = descending && diff == -1
+	}
+	if repeated {
+		return fmt.Errorf("%w: repeated digits", ErrWeakPin)
+	}
+	if ascending || descending {
+		return fmt.Errorf("%w: sequential digits", ErrWeakPin)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Receipt struct {
+	ReferenceId string
+	MachineId   string
+	CardNumber  string // masked
+	Operation   Operation
+	Amount      int
+	Balance     int
+	Notes       map[int]int
+	ToAccount   string
+	Timestamp   time.Time
+
+	DepositId     string
+	DepositStatus DepositStatus
+	Counterfeit   int // notes held back as counterfeit
+}
+
+func (r *Receipt) String() string {
+	var sb strings.Builder
+	sb.WriteString("-------- ATM RECEIPT --------\n")
+	fmt.Fprintf(&sb, "Date      : %s\n", r.Timestamp.Format("02 Jan 2006 15:04:05"))
+	fmt.Fprintf(&sb, "ATM       : %s\n", r.MachineId)
+	fmt.Fprintf(&sb, "Card      : %s\n", r.CardNumber)
+	fmt.Fprintf(&sb, "Ref No    : %s\n", r.ReferenceId)
+	fmt.Fprintf(&sb, "Operation : %s\n", r.Operation)
+	fmt.Fprintf(&sb, "Amount    : %d\n", r.Amount)
+	if r.ToAccount != "" {
+		fmt.Fprintf(&sb, "To        : %s\n", r.ToAccount)
+	}
+	denominations := make([]int, 0, len(r.Notes))
+	for d := range r.Notes {
+		denominations = append(denominations, d)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(denominations)))
+	for _, d := range denominations {
+		if r.Notes[d] > 0 {
+			fmt.Fprintf(&sb, "  %4d x %d\n", d, r.Notes[d])
+		}
+	}
+	if r.DepositId != "" {
+		fmt.Fprintf(&sb, "Deposit   : %s %s\n", r.DepositId, r.DepositStatus)
+		if r.Counterfeit > 0 {
+			fmt.Fprintf(&sb, "Rejected  : %d suspect note(s)\n", r.Counterfeit)
+		}
+	}
+	fmt.Fprintf(&sb, "Balance   : %d\n", r.Balance)
+	sb.WriteString("-----------------------------\n")
+	return sb.String()
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReceiptListsEveryDenomination(t *testing.T) {
+	r := &Receipt{Operation: WITHDRAW, Amount: 170, Notes: map[int]int{10: 2, 50: 3, 20: 0}}
+
+	got := r.String()
+	fifties := strings.Index(got, "  50 x 3\n")
+	tens := strings.Index(got, "  10 x 2\n")
+	if fifties < 0 || tens < 0 {
+		t.Fatalf("receipt is missing the note breakdown:\n%s", got)
+	}
+	if fifties > tens {
+		t.Errorf("notes not listed largest first:\n%s", got)
+	}
+	if strings.Contains(got, "20 x") {
+		t.Errorf("receipt lists a denomination that was not dispensed:\n%s", got)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrSessionTimeout   = errors.New("Session timed out")
+	ErrCardNotCollected = errors.New("Card not collected")
+)
+
+// SessionTimeouts control how long the machine waits for the user. A zero
+// value disables that timeout.
+type SessionTimeouts struct {
+	CardInserted   time.Duration // waiting for a PIN
+	Authenticated  time.Duration // waiting for the next operation
+	CardCollection time.Duration // ejected card left in the slot
+	PollInterval   time.Duration // how often Run checks the timeouts
+}
+
+var DefaultSessionTimeouts = SessionTimeouts{
+	CardInserted:   30 * time.Second,
+	Authenticated:  60 * time.Second,
+	CardCollection: 30 * time.Second,
+	PollInterval:   time.Second,
+}
+
+func (atm *AtmMachine) SetTimeouts(t SessionTimeouts) {
+	atm.mu.Lock()
+	defer atm.mu.Unlock()
+	atm.timeouts = t
+}
+
+func (atm *AtmMachine) SetClock(c Clock) {
+	atm.mu.Lock()
+	defer atm.mu.Unlock()
+	atm.clock = c
+	atm.lastActivity = c.Now()
+}
+
+// Run checks session timeouts until ctx is cancelled.
+func (atm *AtmMachine) Run(ctx context.Context) error {
+	for {
+		atm.mu.Lock()
+		clock, interval := atm.clock, atm.timeouts.PollInterval
+		atm.mu.Unlock()
+
+		if interval <= 0 {
+			interval = DefaultSessionTimeouts.PollInterval
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-clock.After(interval):
+			atm.CheckTimeouts()
+			atm.VerifyDeposits()
+		}
+	}
+}
+
+// CheckTimeouts ejects the card of an idle session and retains a card that
+// was ejected but never collected.
+func (atm *AtmMachine) CheckTimeouts() {
+	atm.mu.Lock()
+	defer atm.mu.Unlock()
+
+	now := atm.now()
+
+	if atm.presentedCard != nil && atm.timeouts.CardCollection > 0 &&
+		now.Sub(atm.presentedAt) >= atm.timeouts.CardCollection {
+		card := atm.presentedCard
+		atm.presentedCard = nil
+		atm.retainedCards = append(atm.retainedCards, card)
+		atm.record(CARD_RETAINED, card, 0, ErrCardNotCollected)
+	}
+
+	timeout := atm.stateTimeout()
+	if timeout > 0 && now.Sub(atm.lastActivity) >= timeout {
+		atm.record(SESSION_TIMEOUT, atm.card, 0, ErrSessionTimeout)
+		atm.ejectCard()
+	}
+}
+
+// TakeCard is the user pulling an ejected card out of the slot.
+func (atm *AtmMachine) TakeCard() (*Card, error) {
+	atm.mu.Lock()
+	defer atm.mu.Unlock()
+
+	if atm.presentedCard == nil {
+		return nil, fmt.Errorf("No card to take")
+	}
+	card := atm.presentedCard
+	atm.presentedCard = nil
+	atm.touch()
+	return card, nil
+}
+
+func (atm *AtmMachine) stateTimeout() time.Duration {
+	switch atm.state.(type) {
+	case *CardInsertedState:
+		return atm.timeouts.CardInserted
+	case *AuthenticatedState:
+		return atm.timeouts.Authenticated
+	default:
+		return 0
+	}
+}
+
+func (atm *AtmMachine) touch() {
+	atm.lastActivity = atm.now()
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var testTimeouts = SessionTimeouts{
+	CardInserted:   30 * time.Second,
+	Authenticated:  60 * time.Second,
+	CardCollection: 20 * time.Second,
+	PollInterval:   time.Second,
+}
+
+type runningAtm struct {
+	*atmFixture
+	clock  *FakeClock
+	cancel context.CancelFunc
+	done   chan error
+}
+
+// startRun drives f.atm.Run on a FakeClock until the test ends.
+func startRun(t *testing.T) *runningAtm {
+	t.Helper()
+
+	f := newAtmFixture(t)
+	clock := NewFakeClock(time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC))
+	f.atm.SetClock(clock)
+	f.atm.SetTimeouts(testTimeouts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &runningAtm{atmFixture: f, clock: clock, cancel: cancel, done: make(chan error, 1)}
+	go func() { r.done <- f.atm.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		<-r.done
+	})
+
+	r.waitParked(t)
+	return r
+}
+
+// waitParked waits until Run is blocked on the clock, which also means the
+// previous round of timeout checks has finished.
+func (r *runningAtm) waitParked(t *testing.T) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for r.clock.Waiters() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Run never waited on the clock")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (r *runningAtm) advance(t *testing.T, d time.Duration) {
+	t.Helper()
+	r.clock.Advance(d)
+	r.waitParked(t)
+}
+
+func (r *runningAtm) wantState(t *testing.T, want string) {
+	t.Helper()
+	if got := r.atm.StateName(); got != want {
+		t.Fatalf("state = %s, want %s", got, want)
+	}
+}
+
+func TestSessionTimeoutEjectsCard(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, r *runningAtm)
+		state   string
+		timeout time.Duration
+	}{
+		{
+			name: "card inserted",
+			setup: func(t *testing.T, r *runningAtm) {
+				if err := r.atm.InsertCard(r.card); err != nil {
+					t.Fatal(err)
+				}
+			},
+			state:   "CardInsertedState",
+			timeout: testTimeouts.CardInserted,
+		},
+		{
+			name: "authenticated",
+			setup: func(t *testing.T, r *runningAtm) {
+				if err := r.atm.InsertCard(r.card); err != nil {
+					t.Fatal(err)
+				}
+				if err := r.atm.EnterPin(testPin); err != nil {
+					t.Fatal(err)
+				}
+			},
+			state:   "AuthenticatedState",
+			timeout: testTimeouts.Authenticated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := startRun(t)
+			tt.setup(t, r)
+
+			r.advance(t, tt.timeout-time.Second)
+			r.wantState(t, tt.state)
+
+			r.advance(t, time.Second)
+			r.wantState(t, "IdleState")
+			if r.atm.HasCard() {
+				t.Error("card still in the reader after timeout")
+			}
+
+			card, err := r.atm.TakeCard()
+			if err != nil {
+				t.Fatalf("TakeCard: %v", err)
+			}
+			if card != r.card {
+				t.Errorf("ejected card %s, want %s", card.number, r.card.number)
+			}
+		})
+	}
+}
+
+func TestUncollectedCardIsRetained(t *testing.T) {
+	r := startRun(t)
+	if err := r.atm.InsertCard(r.card); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.atm.Exit(); err != nil {
+		t.Fatal(err)
+	}
+
+	r.advance(t, testTimeouts.CardCollection-time.Second)
+	if n := len(r.atm.RetainedCards()); n != 0 {
+		t.Fatalf("retained %d cards before CardCollection elapsed", n)
+	}
+
+	r.advance(t, time.Second)
+	cards := r.atm.RetainedCards()
+	if len(cards) != 1 || cards[0] != r.card {
+		t.Fatalf("retained cards = %v, want the ejected card", cards)
+	}
+	if _, err := r.atm.TakeCard(); err == nil {
+		t.Error("retained card can still be taken")
+	}
+	r.wantState(t, "IdleState")
+}
+
+func TestRunStopsWhenContextCancelled(t *testing.T) {
+	r := startRun(t)
+	r.cancel()
+
+	select {
+	case err := <-r.done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Run returned %v, want context.Canceled", err)
+		}
+		r.done <- err // let the cleanup see Run has exited
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not stop after cancel")
+	}
+}
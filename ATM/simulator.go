@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Simulator drives an AtmMachine from a line based terminal menu. Input can
+// be a real terminal or a script piped into stdin.
+type Simulator struct {
+	atm   *AtmMachine
+	cards []*Card
+	in    *bufio.Scanner
+	out   io.Writer
+	tty   bool // hide PIN echo when reading from a terminal
+}
+
+func NewSimulator(atm *AtmMachine, cards []*Card, in io.Reader, out io.Writer) *Simulator {
+	s := &Simulator{
+		atm:   atm,
+		cards: cards,
+		in:    bufio.NewScanner(in),
+		out:   out,
+	}
+	if f, ok := in.(*os.File); ok {
+		if info, err := f.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			s.tty = true
+		}
+	}
+	return s
+}
+
+func (s *Simulator) Run() {
+	fmt.Fprintf(s.out, "Welcome to %s\n", s.atm.id)
+
+	for {
+		fmt.Fprintf(s.out, "\n[%s]\n", s.atm.StateName())
+
+		var ok bool
+		switch s.atm.State().(type) {
+		case *IdleState:
+			ok = s.idleMenu()
+		case *CardInsertedState:
+			ok = s.cardInsertedMenu()
+		case *AuthenticatedState:
+			ok = s.authenticatedMenu()
+		default:
+			fmt.Fprintln(s.out, "Machine unavailable")
+			return
+		}
+		if !ok {
+			break
+		}
+	}
+
+	if s.atm.HasCard() {
+		s.eject()
+	}
+	fmt.Fprintln(s.out, "Goodbye")
+}
+
+func (s *Simulator) idleMenu() bool {
+	choice, ok := s.choose("1) Insert card", "0) Quit")
+	if !ok || choice == 0 {
+		return false
+	}
+	if choice != 1 {
+		fmt.Fprintln(s.out, "Invalid choice")
+		return true
+	}
+
+	options := make([]string, 0, len(s.cards))
+	for i, c := range s.cards {
+		options = append(options, fmt.Sprintf("%d) %s (%s)", i+1, maskCardNumber(c.number), c.userId))
+	}
+	idx, ok := s.choose(options...)
+	if !ok {
+		return false
+	}
+	if idx < 1 || idx > len(s.cards) {
+		fmt.Fprintln(s.out, "Invalid card")
+		return true
+	}
+
+	s.do(func() error { return s.atm.InsertCard(s.cards[idx-1]) })
+	return true
+}
+
+func (s *Simulator) cardInsertedMenu() bool {
+	choice, ok := s.choose("1) Enter PIN", "2) Eject card")
+	if !ok {
+		return false
+	}
+
+	switch choice {
+	case 1:
+		pin, ok := s.readPin("PIN: ")
+		if !ok {
+			return false
+		}
+		s.do(func() error { return s.atm.EnterPin(pin) })
+	case 2:
+		s.eject()
+	default:
+		fmt.Fprintln(s.out, "Invalid choice")
+	}
+	return true
+}
+
+func (s *Simulator) authenticatedMenu() bool {
+	choice, ok := s.choose("1) Check balance", "2) Withdraw", "3) Deposit", "4) Eject card",
+		"5) Transfer", "6) Mini statement", "7) Change PIN")
+	if !ok {
+		return false
+	}
+
+	switch choice {
+	case 1:
+		s.respond(s.atm.CheckBalance())
+	case 2:
+		amt, ok := s.readAmount()
+		if !ok {
+			return false
+		}
+		s.respond(s.atm.Withdraw(amt))
+	case 3:
+		amt, ok := s.readAmount()
+		if !ok {
+			return false
+		}
+		notes, ok := s.readNotes()
+		if !ok {
+			return false
+		}
+		s.respond(s.atm.Deposit(&CashDeposit{Declared: amt, Notes: notes}))
+	case 4:
+		s.eject()
+	case 5:
+		fmt.Fprint(s.out, "To account: ")
+		toAccountId, ok := s.readLine()
+		if !ok {
+			return false
+		}
+		amt, ok := s.readAmount()
+		if !ok {
+			return false
+		}
+		s.respond(s.atm.Transfer(toAccountId, amt))
+	case 6:
+		s.respond(s.atm.MiniStatement(5))
+	case 7:
+		oldPin, ok := s.readPin("Current PIN: ")
+		if !ok {
+			return false
+		}
+		newPin, ok := s.readPin("New PIN: ")
+		if !ok {
+			return false
+		}
+		if err := s.do(func() error { return s.atm.ChangePin(oldPin, newPin) }); err == nil {
+			fmt.Fprintln(s.out, "PIN changed")
+		}
+	default:
+		fmt.Fprintln(s.out, "Invalid choice")
+	}
+	return true
+}
+
+// eject returns the card and has the user take it straight away.
+func (s *Simulator) eject() {
+	s.do(func() error { return s.atm.Exit() })
+	if _, err := s.atm.TakeCard(); err == nil {
+		fmt.Fprintln(s.out, "Card returned")
+	}
+}
+
+// do runs an operation and prints the outcome along with any state change.
+func (s *Simulator) do(op func() error) error {
+	before := s.atm.StateName()
+	err := op()
+	if err != nil {
+		fmt.Fprintln(s.out, "Error:", err)
+	}
+	if after := s.atm.StateName(); after != before {
+		fmt.Fprintf(s.out, "State: %s -> %s\n", before, after)
+	}
+	return err
+}
+
+func (s *Simulator) respond(resp *AtmResponse, err error) {
+	if err != nil {
+		fmt.Fprintln(s.out, "Error:", err)
+		return
+	}
+
+	switch {
+	case resp.Receipt != nil:
+		fmt.Fprint(s.out, resp.Receipt)
+	case resp.Operation == MINI_STATEMENT:
+		for _, t := range resp.Transactions {
+			fmt.Fprintf(s.out, "%s  %-6s %8d  %-28s bal %d\n",
+				t.Timestamp.Format("02 Jan 15:04"), t.Type, t.Amount, t.Description, t.Balance)
+		}
+		fmt.Fprintf(s.out, "Available balance: %d\n", resp.Balance)
+	default:
+		fmt.Fprintf(s.out, "Available balance: %d\n", resp.Balance)
+	}
+}
+
+func (s *Simulator) choose(options ...string) (int, bool) {
+	for _, o := range options {
+		fmt.Fprintln(s.out, o)
+	}
+	fmt.Fprint(s.out, "> ")
+
+	line, ok := s.readLine()
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(line)
+	if err != nil {
+		return -1, true
+	}
+	return n, true
+}
+
+func (s *Simulator) readAmount() (int, bool) {
+	fmt.Fprint(s.out, "Amount: ")
+	line, ok := s.readLine()
+	if !ok {
+		return 0, false
+	}
+	amt, err := strconv.Atoi(line)
+	if err != nil {
+		return 0, true
+	}
+	return amt, true
+}
+
+// readNotes reads notes as "500x2 100x3". A "!" after the denomination, as in
+// "500!x1", marks notes the validator flagged as counterfeit.
+func (s *Simulator) readNotes() ([]Note, bool) {
+	fmt.Fprint(s.out, "Notes: ")
+	line, ok := s.readLine()
+	if !ok {
+		return nil, false
+	}
+
+	notes := make([]Note, 0)
+	for _, field := range strings.Fields(line) {
+		denomination, count, found := strings.Cut(field, "x")
+		if !found {
+			count = "1"
+		}
+		counterfeit := strings.HasSuffix(denomination, "!")
+		d, err := strconv.Atoi(strings.TrimSuffix(denomination, "!"))
+		if err != nil {
+			continue
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			continue
+		}
+		for i := 0; i < n; i++ {
+			notes = append(notes, Note{Denomination: d, Counterfeit: counterfeit})
+		}
+	}
+	return notes, true
+}
+
+func (s *Simulator) readPin(prompt string) (string, bool) {
+	fmt.Fprint(s.out, prompt)
+
+	if s.tty {
+		setEcho(false)
+		defer setEcho(true)
+	}
+	line, ok := s.readLine()
+	if !ok {
+		return "", false
+	}
+	fmt.Fprintln(s.out, strings.Repeat("*", len(line)))
+	return line, true
+}
+
+func (s *Simulator) readLine() (string, bool) {
+	if !s.in.Scan() {
+		return "", false
+	}
+	return strings.TrimSpace(s.in.Text()), true
+}
+
+func setEcho(on bool) {
+	arg := "-echo"
+	if on {
+		arg = "echo"
+	}
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = os.Stdin
+	cmd.Run()
+}
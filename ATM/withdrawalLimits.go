@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+type LimitType string
+
+const (
+	DAILY_LIMIT       LimitType = "DAILY_LIMIT"
+	TRANSACTION_LIMIT LimitType = "TRANSACTION_LIMIT"
+)
+
+// WithdrawalLimits caps cash withdrawals for an account. Zero means no limit.
+type WithdrawalLimits struct {
+	Daily          int
+	PerTransaction int
+}
+
+var DefaultWithdrawalLimits = WithdrawalLimits{
+	Daily:          25000,
+	PerTransaction: 10000,
+}
+
+type LimitExceededError struct {
+	Limit     LimitType
+	Max       int
+	Requested int
+	Remaining int // still available today for DAILY_LIMIT
+}
+
+func (e *LimitExceededError) Error() string {
+	switch e.Limit {
+	case DAILY_LIMIT:
+		return fmt.Sprintf("Daily withdrawal limit of %d exceeded: %d remaining today", e.Max, e.Remaining)
+	default:
+		return fmt.Sprintf("Amount %d exceeds per transaction limit of %d", e.Requested, e.Max)
+	}
+}
+
+// dailyUsage tracks how much was withdrawn on one calendar day in the
+// account's timezone.
+type dailyUsage struct {
+	day       string
+	withdrawn int
+}
+
+func dayKey(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format("2006-01-02")
+}
+
+// checkLimits validates amt against the account's limits, resetting the
+// daily total when the account's local date has moved past midnight.
+func (a *Account) checkLimits(amt int, now time.Time) error {
+	limits := a.limits
+	if limits.PerTransaction > 0 && amt > limits.PerTransaction {
+		return &LimitExceededError{
+			Limit:     TRANSACTION_LIMIT,
+			Max:       limits.PerTransaction,
+			Requested: amt,
+		}
+	}
+
+	today := dayKey(now, a.location)
+	if a.usage.day != today {
+		a.usage = dailyUsage{day: today}
+	}
+
+	if limits.Daily > 0 && a.usage.withdrawn+amt > limits.Daily {
+		return &LimitExceededError{
+			Limit:     DAILY_LIMIT,
+			Max:       limits.Daily,
+			Requested: amt,
+			Remaining: limits.Daily - a.usage.withdrawn,
+		}
+	}
+	return nil
+}
+
+func (a *Account) recordWithdrawal(amt int) {
+	a.usage.withdrawn += amt
+}
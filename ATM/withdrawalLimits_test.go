@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWithdrawalLimitsResetAtLocalMidnight(t *testing.T) {
+	ist := time.FixedZone("IST", 5*3600+1800)
+	// 23:00 in IST is 17:30 UTC, so the UTC date does not change at local
+	// midnight.
+	clock := NewFakeClock(time.Date(2026, 1, 5, 23, 0, 0, 0, ist))
+
+	srv := NewAccountService()
+	srv.SetClock(clock)
+	account, err := srv.CreateAccount("user1", testPin, 100000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetTimezone(account, ist)
+	srv.SetWithdrawalLimits(account, WithdrawalLimits{Daily: 5000, PerTransaction: 2000})
+
+	withdraw := func(amt int) error {
+		t.Helper()
+		_, err := srv.Withdraw(account, amt)
+		return err
+	}
+	wantLimit := func(err error, limit LimitType, remaining int) {
+		t.Helper()
+		var limitErr *LimitExceededError
+		if !errors.As(err, &limitErr) {
+			t.Fatalf("err = %v, want %s", err, limit)
+		}
+		if limitErr.Limit != limit || limitErr.Remaining != remaining {
+			t.Fatalf("got %s with %d remaining, want %s with %d", limitErr.Limit, limitErr.Remaining, limit, remaining)
+		}
+	}
+
+	wantLimit(withdraw(2001), TRANSACTION_LIMIT, 0)
+	for _, amt := range []int{2000, 2000} {
+		if err := withdraw(amt); err != nil {
+			t.Fatalf("Withdraw(%d): %v", amt, err)
+		}
+	}
+	wantLimit(withdraw(2000), DAILY_LIMIT, 1000)
+	if err := withdraw(1000); err != nil {
+		t.Fatalf("Withdraw up to the daily limit: %v", err)
+	}
+	wantLimit(withdraw(1), DAILY_LIMIT, 0)
+
+	clock.Advance(59*time.Minute + 59*time.Second)
+	wantLimit(withdraw(1), DAILY_LIMIT, 0)
+
+	clock.Advance(time.Second)
+	if err := withdraw(2000); err != nil {
+		t.Fatalf("Withdraw after local midnight: %v", err)
+	}
+	if got := srv.Balance(account); got != 100000-7000 {
+		t.Errorf("balance = %d, want %d", got, 100000-7000)
+	}
+}
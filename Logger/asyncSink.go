@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+type OverflowPolicy string
+
+const (
+	BLOCK       OverflowPolicy = "BLOCK"       // caller waits for room in the queue
+	DROP_NEWEST OverflowPolicy = "DROP_NEWEST" // incoming entry is discarded
+	DROP_OLDEST OverflowPolicy = "DROP_OLDEST" // oldest queued entry is discarded
+)
+
+type AsyncConfig struct {
+	QueueSize int
+	Overflow  OverflowPolicy
+}
+
+// queued is an entry with its position in the queue. Sends are serialised
+// so seq increases in the order run receives entries.
+type queued struct {
+	entry *Log
+	seq   uint64
+}
+
+type AsyncSink struct {
+	next     LogSink
+	queue    chan queued
+	overflow OverflowPolicy
+	done     chan struct{}
+
+	// guards closed so nothing is sent on a closed queue
+	closeMu sync.RWMutex
+	closed  bool
+
+	// held while sending so seq matches queue order
+	sendMu sync.Mutex
+	sent   uint64
+
+	mu      sync.Mutex
+	written *sync.Cond
+	last    uint64 // seq of the last entry run finished writing
+	dropped int
+	lastErr error
+}
+
+func NewAsyncSink(next LogSink, cfg AsyncConfig) *AsyncSink {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1024
+	}
+	if cfg.Overflow == "" {
+		cfg.Overflow = BLOCK
+	}
+
+	s := &AsyncSink{
+		next:     next,
+		queue:    make(chan queued, cfg.QueueSize),
+		overflow: cfg.Overflow,
+		done:     make(chan struct{}),
+	}
+	s.written = sync.NewCond(&s.mu)
+
+	go s.run()
+	return s
+}
+
+func (s *AsyncSink) Write(entry *Log) error {
+	s.closeMu.RLock()
+	defer s.closeMu.RUnlock()
+
+	if s.closed {
+		return s.next.Write(entry)
+	}
+
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	item := queued{entry: entry, seq: s.sent + 1}
+
+	switch s.overflow {
+	case DROP_NEWEST:
+		select {
+		case s.queue <- item:
+		default:
+			s.drop()
+			return nil
+		}
+	case DROP_OLDEST:
+		for sent := false; !sent; {
+			select {
+			case s.queue <- item:
+				sent = true
+			default:
+				// make room by discarding the head of the queue
+				select {
+				case <-s.queue:
+					s.drop()
+				default:
+				}
+			}
+		}
+	default:
+		s.queue <- item
+	}
+
+	s.mu.Lock()
+	s.sent = item.seq
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *AsyncSink) run() {
+	defer close(s.done)
+
+	for item := range s.queue {
+		s.reportDropped()
+		err := s.next.Write(item.entry)
+
+		s.mu.Lock()
+		if err != nil {
+			s.lastErr = err
+		}
+		s.last = item.seq
+		s.written.Broadcast()
+		s.mu.Unlock()
+	}
+}
+
+// Flush waits until every entry queued before the call has reached the
+// underlying sink, then flushes that sink too. Entries logged while it waits
+// are not waited for.
+func (s *AsyncSink) Flush() error {
+	s.mu.Lock()
+	// An entry dropped from the head of the queue is only dropped to make
+	// room for a later one, so run always reaches a seq at or past target.
+	target := s.sent
+	for s.last < target {
+		s.written.Wait()
+	}
+	s.mu.Unlock()
+
+	s.reportDropped()
+
+	s.mu.Lock()
+	err := s.lastErr
+	s.lastErr = nil
+	s.mu.Unlock()
+
+	if f, ok := s.next.(interface{ Flush() error }); ok {
+		if flushErr := f.Flush(); flushErr != nil {
+			err = flushErr
+		}
+	}
+	return err
+}
+
+// Close drains the queue, stops the background goroutine and closes the
+// underlying sink. Later writes go straight to the underlying sink.
+func (s *AsyncSink) Close() error {
+	s.closeMu.Lock()
+	if s.closed {
+		s.closeMu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.queue)
+	s.closeMu.Unlock()
+
+	<-s.done
+	s.reportDropped()
+
+	s.mu.Lock()
+	err := s.lastErr
+	s.lastErr = nil
+	s.mu.Unlock()
+
+	if c, ok := s.next.(io.Closer); ok {
+		if closeErr := c.Close(); closeErr != nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+func (s *AsyncSink) drop() {
+	s.mu.Lock()
+	s.dropped++
+	s.mu.Unlock()
+}
+
+// reportDropped writes a single WARN entry summarising entries lost to the
+// overflow policy since the last report.
+func (s *AsyncSink) reportDropped() {
+	s.mu.Lock()
+	n := s.dropped
+	s.dropped = 0
+	s.mu.Unlock()
+
+	if n == 0 {
+		return
+	}
+	s.next.Write(&Log{
+		logLevel:  WARN,
+		timestamp: time.Now(),
+		message:   fmt.Sprintf("dropped %d log entries: async queue full", n),
+	})
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gateSink holds every write until release is closed, so tests can keep the
+// async queue full.
+type gateSink struct {
+	next    LogSink
+	entered chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func newGateSink(next LogSink) *gateSink {
+	return &gateSink{next: next, entered: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (g *gateSink) Write(entry *Log) error {
+	g.once.Do(func() { close(g.entered) })
+	<-g.release
+	return g.next.Write(entry)
+}
+
+func (g *gateSink) open() {
+	select {
+	case <-g.release:
+	default:
+		close(g.release)
+	}
+}
+
+func entry(msg string) *Log {
+	return &Log{logLevel: INFO, timestamp: time.Now(), message: msg}
+}
+
+func messages(logs []Log) []string {
+	out := make([]string, 0, len(logs))
+	for _, l := range logs {
+		out = append(out, l.message)
+	}
+	return out
+}
+
+// fillQueue blocks run inside the write of "e1" and queues the rest of msgs
+// behind it.
+func fillQueue(t *testing.T, s *AsyncSink, g *gateSink, msgs ...string) {
+	t.Helper()
+	s.Write(entry("e1"))
+	select {
+	case <-g.entered:
+	case <-time.After(2 * time.Second):
+		t.Fatal("run never picked up the first entry")
+	}
+	for _, m := range msgs {
+		s.Write(entry(m))
+	}
+}
+
+func TestAsyncFlushWritesQueuedEntries(t *testing.T) {
+	logger, logs := NewObserver(WithAsync(AsyncConfig{QueueSize: 4, Overflow: BLOCK}))
+	defer logger.Close()
+
+	var want []string
+	for i := 0; i < 50; i++ {
+		msg := fmt.Sprint("entry ", i)
+		logger.Info(msg)
+		want = append(want, msg)
+	}
+	if err := logger.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if got := messages(logs.All()); !reflect.DeepEqual(got, want) {
+		t.Errorf("after Flush got %v, want %v", got, want)
+	}
+}
+
+func TestAsyncFlushIgnoresLaterEntries(t *testing.T) {
+	logger, logs := NewObserver(WithAsync(AsyncConfig{QueueSize: 8, Overflow: BLOCK}))
+	defer logger.Close()
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				logger.Info("background")
+			}
+		}
+	}()
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	for i := 0; i < 10; i++ {
+		marker := fmt.Sprint("marker ", i)
+		logger.Info(marker)
+
+		flushed := make(chan struct{})
+		go func() {
+			logger.Flush()
+			close(flushed)
+		}()
+		select {
+		case <-flushed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Flush did not return while another goroutine kept logging")
+		}
+		if len(logs.FilterMessage(marker)) != 1 {
+			t.Fatalf("%q not written when Flush returned", marker)
+		}
+	}
+}
+
+func TestAsyncOverflowReportsDropped(t *testing.T) {
+	tests := []struct {
+		policy OverflowPolicy
+		want   []string
+	}{
+		{DROP_NEWEST, []string{"e1", "e2", "e3"}},
+		{DROP_OLDEST, []string{"e1", "e4", "e5"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			logs := &ObservedLogs{}
+			gate := newGateSink(logs)
+			s := NewAsyncSink(gate, AsyncConfig{QueueSize: 2, Overflow: tt.policy})
+			defer s.Close()
+
+			fillQueue(t, s, gate, "e2", "e3", "e4", "e5")
+			gate.open()
+			if err := s.Flush(); err != nil {
+				t.Fatalf("Flush: %v", err)
+			}
+
+			warnings := logs.FilterLevel(WARN)
+			if len(warnings) != 1 || warnings[0].message != "dropped 2 log entries: async queue full" {
+				t.Errorf("warnings = %v, want one dropped-count entry", messages(warnings))
+			}
+			if got := messages(logs.FilterLevel(INFO)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("kept %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAsyncFlushWaitsForEntryBeingWritten(t *testing.T) {
+	logs := &ObservedLogs{}
+	gate := newGateSink(logs)
+	s := NewAsyncSink(gate, AsyncConfig{QueueSize: 2, Overflow: DROP_OLDEST})
+	defer s.Close()
+
+	fillQueue(t, s, gate, "e2", "e3")
+
+	flushed := make(chan struct{})
+	go func() {
+		s.Flush()
+		close(flushed)
+	}()
+	// push everything Flush was waiting on out of the queue
+	s.Write(entry("e4"))
+	s.Write(entry("e5"))
+
+	select {
+	case <-flushed:
+		t.Fatal("Flush returned while e1 was still being written")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	gate.open()
+	select {
+	case <-flushed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Flush did not return after the queue drained")
+	}
+	if got := messages(logs.FilterLevel(INFO)); !reflect.DeepEqual(got, []string{"e1", "e4", "e5"}) {
+		t.Errorf("written %v", got)
+	}
+}
+
+func TestAsyncWriteAfterClose(t *testing.T) {
+	logs := &ObservedLogs{}
+	s := NewAsyncSink(logs, AsyncConfig{QueueSize: 4})
+	s.Write(entry("queued"))
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+
+	if err := s.Write(entry("late")); err != nil {
+		t.Fatalf("Write after Close: %v", err)
+	}
+	if got := messages(logs.All()); !reflect.DeepEqual(got, []string{"queued", "late"}) {
+		t.Errorf("written %v, want the queued entry then the late one", got)
+	}
+}
+
+func TestAsyncCloseClosesSampling(t *testing.T) {
+	logger, logs := NewObserver(WithStacktraceLevel(""), WithSampling(SamplingConfig{
+		Tick:           time.Hour,
+		ReportInterval: time.Hour,
+		Levels:         map[LogType]SamplingRule{ERROR: {First: 1}},
+	}))
+	sampling := logger.core.getSink().(*SamplingSink)
+	logger.EnableAsync(AsyncConfig{QueueSize: 16})
+
+	for i := 0; i < 10; i++ {
+		logger.Error("boom")
+	}
+	if err := logger.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	got := messages(logs.All())
+	if len(got) != 2 || got[0] != "boom" || !strings.HasPrefix(got[1], "suppressed 9 repeated entries") {
+		t.Errorf("written %q, want boom and the suppressed report", got)
+	}
+	select {
+	case <-sampling.done:
+	default:
+		t.Error("sampling goroutine still running after Close")
+	}
+}
+
+func TestEnableAsyncSeesAsyncUnderSampling(t *testing.T) {
+	logger, _ := NewObserver(
+		WithAsync(AsyncConfig{QueueSize: 16}),
+		WithSampling(SamplingConfig{Levels: map[LogType]SamplingRule{INFO: {First: 1}}}),
+	)
+	defer logger.Close()
+
+	logger.EnableAsync(AsyncConfig{QueueSize: 16})
+
+	sampling, ok := logger.core.getSink().(*SamplingSink)
+	if !ok {
+		t.Fatalf("sink = %T, want *SamplingSink", logger.core.getSink())
+	}
+	if _, ok := sampling.next.(*AsyncSink); !ok {
+		t.Fatalf("sampling wraps %T, want *AsyncSink", sampling.next)
+	}
+	if _, ok := sampling.next.(*AsyncSink).next.(*ObservedLogs); !ok {
+		t.Error("EnableAsync added a second async queue")
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import "context"
+
+type loggerCtxKey struct{}
+
+// contextKey maps a value stored in a context.Context to a field name.
+type contextKey struct {
+	name string
+	key  any
+}
+
+func WithContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerCtxKey{}, l)
+}
+
+// FromContext returns the logger stored by WithContext, falling back to the
+// global logger.
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(loggerCtxKey{}).(*Logger); ok {
+		return l
+	}
+	return GetLogger()
+}
+
+// RegisterContextKey makes every *Ctx log call copy ctx.Value(key) into the
+// entry under name.
+func (l *Logger) RegisterContextKey(name string, key any) {
+	l.core.mu.Lock()
+	defer l.core.mu.Unlock()
+
+	for i, k := range l.core.ctxKeys {
+		if k.name == name {
+			l.core.ctxKeys[i].key = key
+			return
+		}
+	}
+	l.core.ctxKeys = append(l.core.ctxKeys, contextKey{name: name, key: key})
+}
+
+func (c *loggerCore) contextFields(ctx context.Context) []Field {
+	if ctx == nil {
+		return nil
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var fields []Field
+	for _, k := range c.ctxKeys {
+		if v := ctx.Value(k.key); v != nil {
+			fields = append(fields, Field{Key: k.name, Value: v})
+		}
+	}
+	return fields
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type Encoder interface {
+	Encode(entry *Log) ([]byte, error)
+}
+
+// ConsoleEncoder renders one human readable line per entry, followed by the
+// stack trace on its own lines when present.
+type ConsoleEncoder struct{}
+
+func (e *ConsoleEncoder) Encode(entry *Log) ([]byte, error) {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "%s [%s]", entry.timestamp.Format(time.RFC3339Nano), entry.logLevel)
+	if entry.caller.Defined() {
+		fmt.Fprintf(&buf, " %s", entry.caller)
+	}
+	fmt.Fprintf(&buf, " %s", entry.message)
+	for _, f := range entry.fields {
+		fmt.Fprintf(&buf, " %s=%v", f.Key, f.Value)
+	}
+	buf.WriteByte('\n')
+
+	if entry.stack != "" {
+		buf.WriteString(entry.stack)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// JSONEncoder renders one JSON object per line. Fixed keys come first in a
+// stable order, followed by the entry's fields.
+type JSONEncoder struct{}
+
+func (e *JSONEncoder) Encode(entry *Log) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+
+	first := true
+	add := func(key string, value any) {
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+
+		v, err := json.Marshal(value)
+		if err != nil {
+			v, _ = json.Marshal(fmt.Sprint(value))
+		}
+		buf.Write(v)
+	}
+
+	add("timestamp", entry.timestamp.Format(time.RFC3339Nano))
+	add("level", entry.logLevel)
+	if entry.caller.Defined() {
+		add("caller", entry.caller.String())
+		add("function", entry.caller.Function)
+	}
+	add("message", entry.message)
+	for _, f := range entry.fields {
+		add(f.Key, f.Value)
+	}
+	if entry.stack != "" {
+		add("stacktrace", entry.stack)
+	}
+
+	buf.WriteString("}\n")
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+type LogSink interface {
+	Write(entry *Log) error
+}
+
+type WriterSink struct {
+	out     io.Writer
+	encoder Encoder
+	mu      sync.Mutex
+}
+
+func NewWriterSink(out io.Writer, enc Encoder) *WriterSink {
+	return &WriterSink{
+		out:     out,
+		encoder: enc,
+	}
+}
+
+func NewConsoleSink(out io.Writer) *WriterSink {
+	return NewWriterSink(out, &ConsoleEncoder{})
+}
+
+func NewJSONSink(out io.Writer) *WriterSink {
+	return NewWriterSink(out, &JSONEncoder{})
+}
+
+func (s *WriterSink) Write(entry *Log) error {
+	line, err := s.encoder.Encode(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.out.Write(line)
+	return err
+}
+
+func (l *Logger) Info(msg string)  { l.log(context.Background(), INFO, msg) }
+func (l *Logger) Warn(msg string)  { l.log(context.Background(), WARN, msg) }
+func (l *Logger) Error(msg string) { l.log(context.Background(), ERROR, msg) }
+
+func (l *Logger) InfoCtx(ctx context.Context, msg string)  { l.log(ctx, INFO, msg) }
+func (l *Logger) WarnCtx(ctx context.Context, msg string)  { l.log(ctx, WARN, msg) }
+func (l *Logger) ErrorCtx(ctx context.Context, msg string) { l.log(ctx, ERROR, msg) }
+
+// With returns a child logger that adds fields to every entry. The child
+// shares its parent's sink and registered context keys.
+func (l *Logger) With(fields ...Field) *Logger {
+	combined := make([]Field, 0, len(l.fields)+len(fields))
+	combined = append(combined, l.fields...)
+	combined = append(combined, fields...)
+
+	return &Logger{
+		core:       l.core,
+		fields:     combined,
+		callerSkip: l.callerSkip,
+	}
+}
+
+// AddCallerSkip returns a child logger that reports the caller n frames
+// further up the stack, for use inside logging wrappers.
+func (l *Logger) AddCallerSkip(n int) *Logger {
+	child := l.With()
+	child.callerSkip += n
+	return child
+}
+
+func (l *Logger) log(ctx context.Context, level LogType, msg string) {
+	entry := &Log{
+		logLevel:  level,
+		timestamp: time.Now(),
+		message:   msg,
+		fields:    append(l.fields[:len(l.fields):len(l.fields)], l.core.contextFields(ctx)...),
+	}
+
+	// skip runtime.Callers, the capture helper, log and the level method
+	skip := 4 + l.callerSkip
+	entry.caller = captureCaller(skip)
+	if stackLevel := l.core.getStackLevel(); stackLevel != "" && level.atLeast(stackLevel) {
+		entry.stack = captureStack(skip)
+	}
+
+	l.core.getSink().Write(entry)
+}
+
+func captureCaller(skip int) Caller {
+	pc := make([]uintptr, 1)
+	if runtime.Callers(skip, pc) == 0 {
+		return Caller{}
+	}
+	return callerFromPC(pc[0])
+}
+
+func callerFromPC(pc uintptr) Caller {
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	return Caller{
+		File:     frame.File,
+		Line:     frame.Line,
+		Function: frame.Function,
+		pc:       pc,
+	}
+}
+
+func captureStack(skip int) string {
+	pc := make([]uintptr, 64)
+	n := runtime.Callers(skip, pc)
+	frames := runtime.CallersFrames(pc[:n])
+
+	var sb strings.Builder
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&sb, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+func (c *loggerCore) getStackLevel() LogType {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.stackLevel
+}
+
+func (c *loggerCore) getSink() LogSink {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.sink
+}
+
+// EnableAsync moves writes off the caller's goroutine. Entries are queued and
+// written by a background goroutine until Close is called.
+func (l *Logger) EnableAsync(cfg AsyncConfig) {
+	l.core.mu.Lock()
+	defer l.core.mu.Unlock()
+
+	if isAsync(l.core.sink) {
+		return
+	}
+	l.core.sink = NewAsyncSink(l.core.sink, cfg)
+}
+
+// isAsync reports whether sink already queues entries, either itself or
+// beneath sampling as WithAsync followed by WithSampling sets up.
+func isAsync(sink LogSink) bool {
+	if s, ok := sink.(*SamplingSink); ok {
+		sink = s.next
+	}
+	_, ok := sink.(*AsyncSink)
+	return ok
+}
+
+// Flush blocks until every entry logged so far has been written.
+func (l *Logger) Flush() error {
+	if f, ok := l.core.getSink().(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Close drains pending entries and stops any background goroutines owned by
+// the sink. An async logger switches back to synchronous writes.
+func (l *Logger) Close() error {
+	l.core.mu.Lock()
+	sink := l.core.sink
+	if s, ok := sink.(*AsyncSink); ok {
+		l.core.sink = s.next
+	}
+	l.core.mu.Unlock()
+
+	if c, ok := sink.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (e Log) Level() LogType       { return e.logLevel }
+func (e Log) Timestamp() time.Time { return e.timestamp }
+func (e Log) Message() string      { return e.message }
+func (e Log) Fields() []Field      { return e.fields }
+func (e Log) Caller() Caller       { return e.caller }
+func (e Log) Stack() string        { return e.stack }
+
+func (c Caller) Defined() bool {
+	return c.File != ""
+}
+
+// String returns the caller as dir/file.go:line.
+func (c Caller) String() string {
+	if !c.Defined() {
+		return "undefined"
+	}
+	file := c.File
+	if idx := strings.LastIndexByte(file, '/'); idx >= 0 {
+		if prev := strings.LastIndexByte(file[:idx], '/'); prev >= 0 {
+			file = file[prev+1:]
+		}
+	}
+	return fmt.Sprintf("%s:%d", file, c.Line)
+}
+
+func (e Log) Field(key string) (any, bool) {
+	for _, f := range e.fields {
+		if f.Key == key {
+			return f.Value, true
+		}
+	}
+	return nil, false
+}
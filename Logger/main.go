@@ -1,6 +1,11 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
 	"time"
 )
 
@@ -66,16 +71,132 @@ const (
 	ERROR LogType = "ERROR"
 )
 
+var severity = map[LogType]int{
+	INFO:  0,
+	WARN:  1,
+	ERROR: 2,
+}
+
+func (t LogType) atLeast(other LogType) bool {
+	return severity[t] >= severity[other]
+}
+
 type Log struct {
 	logLevel  LogType
 	timestamp time.Time
 	message   string
+	fields    []Field
+	caller    Caller
+	stack     string
+}
+
+type Caller struct {
+	File     string
+	Line     int
+	Function string
+	pc       uintptr
 }
 
-type Logger struct{}
+type Field struct {
+	Key   string
+	Value any
+}
 
-var instance = &Logger{}
+func F(key string, value any) Field {
+	return Field{Key: key, Value: value}
+}
+
+// loggerCore is shared by a logger and every child created through With.
+type loggerCore struct {
+	sink       LogSink
+	ctxKeys    []contextKey
+	stackLevel LogType // entries at or above this level carry a stack trace
+	mu         sync.RWMutex
+}
+
+type Logger struct {
+	core       *loggerCore
+	fields     []Field
+	callerSkip int
+}
+
+var (
+	instance = New()
+	globalMu sync.RWMutex
+)
 
 func GetLogger() *Logger {
+	globalMu.RLock()
+	defer globalMu.RUnlock()
 	return instance
 }
+
+func main() {
+	logger := GetLogger()
+	logger.Info("server starting")
+
+	logger.EnableAsync(AsyncConfig{QueueSize: 4, Overflow: DROP_OLDEST})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				logger.Warn(fmt.Sprintf("worker %d: request %d slow", worker, j))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	logger.Flush()
+
+	logger.RegisterContextKey("traceId", traceIDKey{})
+	logger.RegisterContextKey("userId", userIDKey{})
+	handleRequest(WithContext(context.Background(), logger.With(F("service", "orders"))), "user42")
+
+	logger.Close()
+
+	observed, logs := NewObserver()
+	restore := ReplaceGlobal(observed)
+	GetLogger().Warn("captured, not printed")
+	restore()
+	fmt.Println("observer captured", logs.Len(), "entries:", logs.FilterLevel(WARN)[0].Message())
+
+	sampled := New(WithStacktraceLevel(""), WithSampling(SamplingConfig{
+		Levels: map[LogType]SamplingRule{ERROR: {First: 3, Thereafter: 250}},
+	}))
+	for i := 0; i < 1000; i++ {
+		sampled.Error("db connection refused")
+	}
+	sampled.Close()
+
+	slog.SetDefault(slog.New(NewSlogHandler(logger)))
+	slog.Warn("cache miss ratio high", "ratio", 0.42, slog.Group("cache", "name", "sessions"))
+
+	throughSlog := New(WithSlogHandler(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{AddSource: true})))
+	throughSlog.With(F("region", "ap-south-1")).Info("written by slog.JSONHandler")
+
+	logger.Error("shutting down")
+}
+
+type traceIDKey struct{}
+type userIDKey struct{}
+
+func logFailure(msg string) {
+	GetLogger().AddCallerSkip(1).Error(msg)
+}
+
+func handleRequest(ctx context.Context, userId string) {
+	ctx = context.WithValue(ctx, traceIDKey{}, "trace-"+userId)
+	ctx = context.WithValue(ctx, userIDKey{}, userId)
+
+	log := FromContext(ctx)
+	log.InfoCtx(ctx, "request received")
+	log.With(F("orderId", 7)).WarnCtx(ctx, "inventory low")
+
+	jsonLog := New(WithJSONOutput(os.Stdout))
+	jsonLog.With(F("userId", userId)).Error("payment declined")
+
+	logFailure("reported through a wrapper")
+}
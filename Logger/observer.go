@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// ObservedLogs is an in-memory sink that keeps every entry so tests can
+// assert on what was logged.
+type ObservedLogs struct {
+	entries []Log
+	mu      sync.Mutex
+}
+
+// NewObserver returns a logger writing only to the returned ObservedLogs.
+func NewObserver(opts ...Option) (*Logger, *ObservedLogs) {
+	logs := &ObservedLogs{}
+	return New(append([]Option{WithSink(logs)}, opts...)...), logs
+}
+
+func (o *ObservedLogs) Write(entry *Log) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.entries = append(o.entries, *entry)
+	return nil
+}
+
+func (o *ObservedLogs) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.entries)
+}
+
+func (o *ObservedLogs) All() []Log {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]Log(nil), o.entries...)
+}
+
+// TakeAll returns the captured entries and resets the observer.
+func (o *ObservedLogs) TakeAll() []Log {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	entries := o.entries
+	o.entries = nil
+	return entries
+}
+
+func (o *ObservedLogs) FilterLevel(level LogType) []Log {
+	return o.filter(func(l Log) bool { return l.logLevel == level })
+}
+
+func (o *ObservedLogs) FilterMessage(substr string) []Log {
+	return o.filter(func(l Log) bool { return strings.Contains(l.message, substr) })
+}
+
+func (o *ObservedLogs) FilterField(key string, value any) []Log {
+	return o.filter(func(l Log) bool {
+		v, ok := l.Field(key)
+		return ok && reflect.DeepEqual(v, value)
+	})
+}
+
+func (o *ObservedLogs) filter(match func(Log) bool) []Log {
+	var out []Log
+	for _, l := range o.All() {
+		if match(l) {
+			out = append(out, l)
+		}
+	}
+	return out
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+)
+
+type Option func(*Logger)
+
+// New builds an independent logger. Without options it writes synchronously
+// to stdout, like the global logger.
+func New(opts ...Option) *Logger {
+	l := &Logger{
+		core: &loggerCore{
+			sink:       NewConsoleSink(os.Stdout),
+			stackLevel: ERROR,
+		},
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+func WithOutput(w io.Writer) Option {
+	return func(l *Logger) {
+		l.core.sink = NewConsoleSink(w)
+	}
+}
+
+func WithJSONOutput(w io.Writer) Option {
+	return func(l *Logger) {
+		l.core.sink = NewJSONSink(w)
+	}
+}
+
+func WithSink(s LogSink) Option {
+	return func(l *Logger) {
+		l.core.sink = s
+	}
+}
+
+// WithSlogHandler sends every entry through h instead of writing it
+// directly. Do not pass a SlogHandler backed by the same logger.
+func WithSlogHandler(h slog.Handler) Option {
+	return func(l *Logger) {
+		l.core.sink = NewSlogSink(h)
+	}
+}
+
+func WithAsync(cfg AsyncConfig) Option {
+	return func(l *Logger) {
+		l.core.sink = NewAsyncSink(l.core.sink, cfg)
+	}
+}
+
+// WithSampling limits repeated messages. Put it after WithAsync so sampled
+// out entries never reach the queue.
+func WithSampling(cfg SamplingConfig) Option {
+	return func(l *Logger) {
+		l.core.sink = NewSamplingSink(l.core.sink, cfg)
+	}
+}
+
+func WithFields(fields ...Field) Option {
+	return func(l *Logger) {
+		l.fields = append(l.fields, fields...)
+	}
+}
+
+func WithCallerSkip(n int) Option {
+	return func(l *Logger) {
+		l.callerSkip += n
+	}
+}
+
+// WithStacktraceLevel sets the lowest level that captures a stack trace.
+// An empty level turns stack traces off.
+func WithStacktraceLevel(level LogType) Option {
+	return func(l *Logger) {
+		l.core.stackLevel = level
+	}
+}
+
+// ReplaceGlobal swaps the logger returned by GetLogger and returns a func
+// that restores the previous one.
+func ReplaceGlobal(l *Logger) func() {
+	globalMu.Lock()
+	prev := instance
+	instance = l
+	globalMu.Unlock()
+
+	return func() {
+		ReplaceGlobal(prev)
+	}
+}
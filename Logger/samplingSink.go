@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// SamplingRule keeps the first First entries with the same message in each
+// tick, then every Thereafter-th one. Thereafter <= 0 drops the rest.
+type SamplingRule struct {
+	First      int
+	Thereafter int
+}
+
+type SamplingConfig struct {
+	Tick           time.Duration
+	ReportInterval time.Duration
+	Levels         map[LogType]SamplingRule // levels without a rule are never sampled
+}
+
+type sampleCounter struct {
+	level      LogType
+	message    string
+	count      int
+	suppressed int
+	windowEnd  time.Time
+}
+
+type SamplingSink struct {
+	next     LogSink
+	cfg      SamplingConfig
+	counters map[string]*sampleCounter
+	mu       sync.Mutex
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewSamplingSink(next LogSink, cfg SamplingConfig) *SamplingSink {
+	if cfg.Tick <= 0 {
+		cfg.Tick = time.Second
+	}
+	if cfg.ReportInterval <= 0 {
+		cfg.ReportInterval = 10 * time.Second
+	}
+
+	s := &SamplingSink{
+		next:     next,
+		cfg:      cfg,
+		counters: make(map[string]*sampleCounter),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go s.run()
+	return s
+}
+
+func (s *SamplingSink) Write(entry *Log) error {
+	rule, ok := s.cfg.Levels[entry.logLevel]
+	if !ok {
+		return s.next.Write(entry)
+	}
+
+	key := string(entry.logLevel) + "|" + entry.message
+
+	s.mu.Lock()
+	counter, ok := s.counters[key]
+	if !ok {
+		counter = &sampleCounter{
+			level:   entry.logLevel,
+			message: entry.message,
+		}
+		s.counters[key] = counter
+	}
+
+	if entry.timestamp.After(counter.windowEnd) {
+		counter.count = 0
+		counter.windowEnd = entry.timestamp.Add(s.cfg.Tick)
+	}
+	counter.count++
+
+	keep := counter.count <= rule.First ||
+		(rule.Thereafter > 0 && (counter.count-rule.First)%rule.Thereafter == 0)
+	if !keep {
+		counter.suppressed++
+	}
+	s.mu.Unlock()
+
+	if !keep {
+		return nil
+	}
+	return s.next.Write(entry)
+}
+
+func (s *SamplingSink) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.cfg.ReportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.report()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// report emits one entry per message that had entries suppressed since the
+// last report, and forgets counters whose window has expired.
+func (s *SamplingSink) report() error {
+	now := time.Now()
+
+	s.mu.Lock()
+	var reports []*Log
+	for key, counter := range s.counters {
+		if counter.suppressed > 0 {
+			reports = append(reports, &Log{
+				logLevel:  counter.level,
+				timestamp: now,
+				message:   fmt.Sprintf("suppressed %d repeated entries: %q", counter.suppressed, counter.message),
+				fields: []Field{
+					F("sampledMessage", counter.message),
+					F("suppressed", counter.suppressed),
+				},
+			})
+			counter.suppressed = 0
+		}
+		if now.After(counter.windowEnd) {
+			delete(s.counters, key)
+		}
+	}
+	s.mu.Unlock()
+
+	var lastErr error
+	for _, entry := range reports {
+		if err := s.next.Write(entry); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func (s *SamplingSink) Flush() error {
+	err := s.report()
+	if f, ok := s.next.(interface{ Flush() error }); ok {
+		if flushErr := f.Flush(); flushErr != nil {
+			err = flushErr
+		}
+	}
+	return err
+}
+
+func (s *SamplingSink) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+
+	err := s.report()
+	if c, ok := s.next.(io.Closer); ok {
+		if closeErr := c.Close(); closeErr != nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+func toSlogLevel(level LogType) slog.Level {
+	switch level {
+	case WARN:
+		return slog.LevelWarn
+	case ERROR:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+func fromSlogLevel(level slog.Level) LogType {
+	switch {
+	case level >= slog.LevelError:
+		return ERROR
+	case level >= slog.LevelWarn:
+		return WARN
+	default:
+		return INFO
+	}
+}
+
+// SlogHandler lets code using log/slog write through a Logger, so both share
+// the same sink, sampling and context keys.
+type SlogHandler struct {
+	logger *Logger
+	level  slog.Leveler
+	attrs  []Field
+	group  string // dotted prefix for attrs added after WithGroup
+}
+
+// NewSlogHandler handles slog.LevelInfo and above. Debug records are dropped
+// since Logger has no level below INFO.
+func NewSlogHandler(l *Logger) *SlogHandler {
+	return &SlogHandler{
+		logger: l,
+		level:  slog.LevelInfo,
+	}
+}
+
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	fields := make([]Field, 0, len(h.logger.fields)+len(h.attrs)+r.NumAttrs())
+	fields = append(fields, h.logger.fields...)
+	fields = append(fields, h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		fields = appendAttr(fields, h.group, a)
+		return true
+	})
+	fields = append(fields, h.logger.core.contextFields(ctx)...)
+
+	entry := &Log{
+		logLevel:  fromSlogLevel(r.Level),
+		timestamp: r.Time,
+		message:   r.Message,
+		fields:    fields,
+	}
+	if entry.timestamp.IsZero() {
+		entry.timestamp = time.Now()
+	}
+	if r.PC != 0 {
+		entry.caller = callerFromPC(r.PC)
+	}
+
+	return h.logger.core.getSink().Write(entry)
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	child := *h
+	child.attrs = append([]Field(nil), h.attrs...)
+	for _, a := range attrs {
+		child.attrs = appendAttr(child.attrs, h.group, a)
+	}
+	return &child
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	child := *h
+	child.group = h.group + name + "."
+	return &child
+}
+
+// appendAttr flattens groups into dotted keys, e.g. "http.status".
+func appendAttr(fields []Field, prefix string, a slog.Attr) []Field {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return fields
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		groupPrefix := prefix
+		if a.Key != "" {
+			groupPrefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			fields = appendAttr(fields, groupPrefix, ga)
+		}
+		return fields
+	}
+
+	return append(fields, Field{Key: prefix + a.Key, Value: a.Value.Any()})
+}
+
+// SlogSink writes Logger entries through any slog.Handler.
+type SlogSink struct {
+	handler slog.Handler
+}
+
+func NewSlogSink(h slog.Handler) *SlogSink {
+	return &SlogSink{
+		handler: h,
+	}
+}
+
+func (s *SlogSink) Write(entry *Log) error {
+	ctx := context.Background()
+	level := toSlogLevel(entry.logLevel)
+	if !s.handler.Enabled(ctx, level) {
+		return nil
+	}
+
+	r := slog.NewRecord(entry.timestamp, level, entry.message, entry.caller.pc)
+	for _, f := range entry.fields {
+		r.AddAttrs(slog.Any(f.Key, f.Value))
+	}
+	if entry.stack != "" {
+		r.AddAttrs(slog.String("stacktrace", entry.stack))
+	}
+	return s.handler.Handle(ctx, r)
+}
@@ -1,7 +1,35 @@
 package main
 
+type EventType string
+
+const (
+	ORDER_UPDATE   EventType = "ORDER_UPDATE"
+	PROMOTION      EventType = "PROMOTION"
+	SECURITY_ALERT EventType = "SECURITY_ALERT"
+)
+
 type Event struct {
-	message string
+	eventType   EventType
+	message     string
+	targetUsers []string // empty means every subscribed user
+	payload     map[string]any
+}
+
+func NewEvent(t EventType, message string, targetUsers ...string) *Event {
+	return &Event{
+		eventType:   t,
+		message:     message,
+		targetUsers: targetUsers,
+		payload:     make(map[string]any),
+	}
+}
+
+// WithPayload sets the values templates fill in for this event.
+func (e *Event) WithPayload(payload map[string]any) *Event {
+	for k, v := range payload {
+		e.payload[k] = v
+	}
+	return e
 }
 
 type EventListener interface {
@@ -19,6 +47,5 @@ func NewNotificationListener(s *NotificationService) *NotificationEventListener
 }
 
 func (s *NotificationEventListener) OnEvent(e *Event) error {
-	s.notificationService.Notify(e)
-	return nil
+	return s.notificationService.Notify(e)
 }
@@ -3,8 +3,10 @@ package main
 type ChannelType string
 
 const (
-	EMAIL ChannelType = "EMAIL"
-	SMS   ChannelType = "SMS"
+	EMAIL   ChannelType = "EMAIL"
+	SMS     ChannelType = "SMS"
+	PUSH    ChannelType = "PUSH"
+	WEBHOOK ChannelType = "WEBHOOK"
 )
 
 type ChannelFactory struct{}
@@ -12,9 +14,13 @@ type ChannelFactory struct{}
 func GetChannel(preferredChanel ChannelType) NotificationChannel {
 	switch preferredChanel {
 	case EMAIL:
-		return &EmailChannel{}
+		return NewEmailChannel(CurrentSettings().SMTP)
 	case SMS:
 		return &SmsChannel{}
+	case PUSH:
+		return &PushChannel{}
+	case WEBHOOK:
+		return NewWebhookChannel(CurrentSettings().Webhook)
 	default:
 		return nil
 	}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrDeadLetterNotFound = errors.New("Dead letter not found")
+
+type DeadLetter struct {
+	Id           string
+	Notification *Notification
+	Chain        []ChannelPreference // replayed from the start
+	Channel      ChannelType         // last channel tried
+	Attempts     int                 // across the whole chain
+	Err          error
+	FailedAt     time.Time
+}
+
+// DeadLetterStore keeps notifications that could not be delivered, oldest
+// first, until they are replayed or discarded.
+type DeadLetterStore struct {
+	letters []*DeadLetter
+	seq     int
+	mu      sync.Mutex
+}
+
+func NewDeadLetterStore() *DeadLetterStore {
+	return &DeadLetterStore{
+		letters: make([]*DeadLetter, 0),
+	}
+}
+
+func (s *DeadLetterStore) add(n *Notification, chain []ChannelPreference, c ChannelType, attempts int, err error) *DeadLetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	letter := &DeadLetter{
+		Id:           fmt.Sprintf("DL%06d", s.seq),
+		Notification: n,
+		Chain:        chain,
+		Channel:      c,
+		Attempts:     attempts,
+		Err:          err,
+		FailedAt:     time.Now(),
+	}
+	s.letters = append(s.letters, letter)
+	return letter
+}
+
+func (s *DeadLetterStore) List() []*DeadLetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*DeadLetter(nil), s.letters...)
+}
+
+func (s *DeadLetterStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.letters)
+}
+
+// Discard drops a dead letter without delivering it.
+func (s *DeadLetterStore) Discard(id string) error {
+	if _, ok := s.take(id); !ok {
+		return ErrDeadLetterNotFound
+	}
+	return nil
+}
+
+func (s *DeadLetterStore) take(id string) (*DeadLetter, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, letter := range s.letters {
+		if letter.Id == id {
+			s.letters = append(s.letters[:i], s.letters[i+1:]...)
+			return letter, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var ErrUnknownChannel = errors.New("Unknown notification channel")
+
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration // delay before the first retry, doubled after each one
+	MaxDelay    time.Duration // 0 means no cap
+	Jitter      float64       // fraction of the delay randomised either way, 0 to 1
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   100 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+	Jitter:      0.2,
+}
+
+// backoff returns the wait before retry number attempt, counting from 1.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay << (attempt - 1)
+	if d>>(attempt-1) != p.BaseDelay {
+		d = time.Duration(math.MaxInt64) // shift overflowed
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		if jittered := d + time.Duration((rand.Float64()*2-1)*p.Jitter*float64(d)); jittered > 0 {
+			d = jittered
+		}
+	}
+	return d
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks a send error that retrying will not fix, such as a bad
+// address.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+func isPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// DeliveryRecord says which channel delivered a notification.
+type DeliveryRecord struct {
+	NotificationId string
+	UserId         string
+	EventType      EventType
+	Channel        ChannelType
+	Attempts       int // across the whole chain
+	DeliveredAt    time.Time
+}
+
+// Dispatcher sends notifications on a channel, retrying failures with
+// exponential backoff. Notifications that still fail end up in the
+// dead-letter store.
+type Dispatcher struct {
+	policies    map[ChannelType]RetryPolicy
+	channels    map[ChannelType]NotificationChannel // overrides GetChannel
+	deadLetters *DeadLetterStore
+	deliveries  []DeliveryRecord
+	delivered   map[string]int // notification id -> index into deliveries
+	sleep       func(time.Duration)
+	mu          sync.RWMutex
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		policies:    make(map[ChannelType]RetryPolicy),
+		channels:    make(map[ChannelType]NotificationChannel),
+		deadLetters: NewDeadLetterStore(),
+		deliveries:  make([]DeliveryRecord, 0),
+		delivered:   make(map[string]int),
+		sleep:       time.Sleep,
+	}
+}
+
+func (d *Dispatcher) SetRetryPolicy(c ChannelType, p RetryPolicy) {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 1
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.policies[c] = p
+}
+
+func (d *Dispatcher) RetryPolicy(c ChannelType) RetryPolicy {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if p, ok := d.policies[c]; ok {
+		return p
+	}
+	return DefaultRetryPolicy
+}
+
+// SetChannel uses ch for type c instead of the one GetChannel builds.
+func (d *Dispatcher) SetChannel(c ChannelType, ch NotificationChannel) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.channels[c] = ch
+}
+
+func (d *Dispatcher) channel(c ChannelType) NotificationChannel {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if ch, ok := d.channels[c]; ok {
+		return ch
+	}
+	return GetChannel(c)
+}
+
+func (d *Dispatcher) DeadLetters() *DeadLetterStore {
+	return d.deadLetters
+}
+
+// Deliver sends n on channel c, retrying up to the channel's MaxAttempts.
+// A notification that cannot be delivered is dead-lettered and the last
+// error returned.
+func (d *Dispatcher) Deliver(n *Notification, c ChannelType) error {
+	return d.DeliverWithFallback(n, []ChannelPreference{{Channel: c}})
+}
+
+// DeliverWithFallback tries each channel of chain in order, moving on once a
+// channel has used up its retry budget. The channel that succeeds is recorded
+// on n and in the dispatcher's delivery log. If none does, n is dead-lettered
+// and every channel's error returned.
+func (d *Dispatcher) DeliverWithFallback(n *Notification, chain []ChannelPreference) error {
+	var errs []error
+	total := 0
+	for _, pref := range chain {
+		attempts, err := d.send(n, pref)
+		total += attempts
+		if err == nil {
+			n.deliveredVia = pref.Channel
+			d.recordDelivery(n, pref.Channel, total)
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s failed after %d attempts: %w", pref.Channel, attempts, err))
+	}
+
+	last := ChannelType("")
+	if len(chain) > 0 {
+		last = chain[len(chain)-1].Channel
+	}
+	err := errors.Join(errs...)
+	d.deadLetters.add(n, chain, last, total, err)
+	return fmt.Errorf("Notification to %s undeliverable: %w", n.userId, err)
+}
+
+func (d *Dispatcher) recordDelivery(n *Notification, c ChannelType, attempts int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.deliveries = append(d.deliveries, DeliveryRecord{
+		NotificationId: n.id,
+		UserId:         n.userId,
+		EventType:      n.eventType,
+		Channel:        c,
+		Attempts:       attempts,
+		DeliveredAt:    time.Now(),
+	})
+	if n.id != "" {
+		d.delivered[n.id] = len(d.deliveries) - 1
+	}
+}
+
+// Delivery returns how the notification with the given id was delivered.
+func (d *Dispatcher) Delivery(notificationId string) (DeliveryRecord, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	i, ok := d.delivered[notificationId]
+	if !ok {
+		return DeliveryRecord{}, false
+	}
+	return d.deliveries[i], true
+}
+
+// Deliveries returns every successful delivery, oldest first.
+func (d *Dispatcher) Deliveries() []DeliveryRecord {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return append([]DeliveryRecord(nil), d.deliveries...)
+}
+
+func (d *Dispatcher) send(n *Notification, pref ChannelPreference) (int, error) {
+	channel := d.channel(pref.Channel)
+	if channel == nil {
+		return 0, Permanent(ErrUnknownChannel)
+	}
+
+	policy := d.RetryPolicy(pref.Channel)
+	if pref.MaxAttempts > 0 {
+		policy.MaxAttempts = pref.MaxAttempts
+	}
+	var err error
+	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			d.sleep(policy.backoff(attempt - 1))
+		}
+		if err = channel.Send(n); err == nil || isPermanent(err) {
+			return attempt, err
+		}
+	}
+	return policy.MaxAttempts, err
+}
+
+// Replay takes the dead letter with the given id out of the store and
+// delivers it again through its whole chain with fresh retry budgets.
+func (d *Dispatcher) Replay(id string) error {
+	letter, ok := d.deadLetters.take(id)
+	if !ok {
+		return ErrDeadLetterNotFound
+	}
+	return d.DeliverWithFallback(letter.Notification, letter.Chain)
+}
+
+// ReplayAll replays every dead letter currently in the store.
+func (d *Dispatcher) ReplayAll() error {
+	var errs []error
+	for _, letter := range d.deadLetters.List() {
+		if err := d.Replay(letter.Id); err != nil && !errors.Is(err, ErrDeadLetterNotFound) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   RetryPolicy
+		attempt  int
+		min, max time.Duration
+	}{
+		{"first retry", RetryPolicy{BaseDelay: 100 * time.Millisecond}, 1, 100 * time.Millisecond, 100 * time.Millisecond},
+		{"doubles", RetryPolicy{BaseDelay: 100 * time.Millisecond}, 4, 800 * time.Millisecond, 800 * time.Millisecond},
+		{"zero MaxDelay is uncapped", RetryPolicy{BaseDelay: time.Second}, 11, 1024 * time.Second, 1024 * time.Second},
+		{"capped", RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}, 10, time.Second, time.Second},
+		{"overflow uncapped", RetryPolicy{BaseDelay: time.Second}, 40, math.MaxInt64, math.MaxInt64},
+		{"overflow capped", RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}, 40, 5 * time.Second, 5 * time.Second},
+		{"shift past 64 bits", RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: time.Minute}, 200, time.Minute, time.Minute},
+		{"no base delay", RetryPolicy{}, 3, 0, 0},
+		{"jitter", RetryPolicy{BaseDelay: time.Second, Jitter: 0.2}, 2, 1600 * time.Millisecond, 2400 * time.Millisecond},
+		{"jitter after cap", RetryPolicy{BaseDelay: time.Second, MaxDelay: 3 * time.Second, Jitter: 0.5}, 5, 1500 * time.Millisecond, 4500 * time.Millisecond},
+		{"jitter on overflow stays positive", RetryPolicy{BaseDelay: time.Second, Jitter: 1}, 40, 1, math.MaxInt64},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 200; i++ {
+				if d := tt.policy.backoff(tt.attempt); d < tt.min || d > tt.max {
+					t.Fatalf("backoff(%d) = %v, want in [%v, %v]", tt.attempt, d, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+// scriptedChannel fails every send with err until fixed.
+type scriptedChannel struct {
+	err   error
+	calls int
+	mu    sync.Mutex
+}
+
+func (c *scriptedChannel) Send(n *Notification) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	return c.err
+}
+
+func (c *scriptedChannel) fix() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = nil
+}
+
+func TestDeliverWithFallbackDeadLetterAndReplay(t *testing.T) {
+	email := &scriptedChannel{err: errors.New("Gateway unavailable")}
+	sms := &scriptedChannel{err: Permanent(ErrNoAddress)}
+
+	d := NewDispatcher()
+	var slept []time.Duration
+	d.sleep = func(delay time.Duration) { slept = append(slept, delay) }
+	d.SetChannel(EMAIL, email)
+	d.SetChannel(SMS, sms)
+	d.SetRetryPolicy(EMAIL, RetryPolicy{MaxAttempts: 3, BaseDelay: 10 * time.Millisecond})
+	d.SetRetryPolicy(SMS, RetryPolicy{MaxAttempts: 3, BaseDelay: 10 * time.Millisecond})
+
+	n := &Notification{id: "N00000001", userId: "user1", eventType: ORDER_UPDATE, message: "shipped"}
+	chain := []ChannelPreference{{Channel: EMAIL, MaxAttempts: 2}, {Channel: SMS}}
+
+	err := d.DeliverWithFallback(n, chain)
+	if err == nil || !errors.Is(err, ErrNoAddress) {
+		t.Fatalf("DeliverWithFallback: err = %v, want both channels' errors", err)
+	}
+	if email.calls != 2 {
+		t.Errorf("email tried %d times, want the preference's 2", email.calls)
+	}
+	if sms.calls != 1 {
+		t.Errorf("sms tried %d times, want 1 for a permanent error", sms.calls)
+	}
+	if len(slept) != 1 || slept[0] != 10*time.Millisecond {
+		t.Errorf("slept %v, want one 10ms backoff", slept)
+	}
+	if _, ok := d.Delivery(n.id); ok {
+		t.Error("undelivered notification has a delivery record")
+	}
+
+	letters := d.DeadLetters().List()
+	if len(letters) != 1 {
+		t.Fatalf("%d dead letters, want 1", len(letters))
+	}
+	letter := letters[0]
+	if letter.Notification != n || letter.Channel != SMS || letter.Attempts != 3 {
+		t.Errorf("dead letter = %+v", letter)
+	}
+
+	email.fix()
+	if err := d.Replay(letter.Id); err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if left := d.DeadLetters().Len(); left != 0 {
+		t.Errorf("%d dead letters left after Replay", left)
+	}
+	if err := d.Replay(letter.Id); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Errorf("second Replay: err = %v, want ErrDeadLetterNotFound", err)
+	}
+
+	rec, ok := d.Delivery(n.id)
+	if !ok {
+		t.Fatal("no delivery record after Replay")
+	}
+	if rec.Channel != EMAIL || rec.Attempts != 1 || rec.UserId != "user1" {
+		t.Errorf("delivery record = %+v", rec)
+	}
+	if n.deliveredVia != EMAIL {
+		t.Errorf("deliveredVia = %s, want EMAIL", n.deliveredVia)
+	}
+}
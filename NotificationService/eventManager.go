@@ -1,25 +1,242 @@
 package main
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var (
+	ErrEventManagerClosed = errors.New("Event manager is shut down")
+	ErrQueueFull          = errors.New("Listener queue full")
+	ErrAlreadySubscribed  = errors.New("Listener already subscribed")
+)
+
+type EventManagerConfig struct {
+	QueueSize int // events buffered per listener before Publish rejects
+	Workers   int // default workers per listener
+}
+
+var DefaultEventManagerConfig = EventManagerConfig{
+	QueueSize: 64,
+	Workers:   1,
+}
+
+// ListenerError records an event a listener failed to handle.
+type ListenerError struct {
+	Listener EventListener
+	Event    *Event
+	Err      error
+}
+
+func (e ListenerError) Error() string {
+	return fmt.Sprintf("listener %T failed on %s event: %v", e.Listener, e.Event.eventType, e.Err)
+}
+
+func (e ListenerError) Unwrap() error {
+	return e.Err
+}
+
+// listenerQueue feeds one listener from its own bounded queue, so a slow
+// listener cannot hold up the others.
+type listenerQueue struct {
+	listener EventListener
+	events   chan *Event
+	wg       sync.WaitGroup
+}
+
+// EventManager dispatches events to its listeners asynchronously. It is safe
+// for concurrent use.
 type EventManager struct {
-	Listners []EventListener
+	queues []*listenerQueue // in subscription order
+	config EventManagerConfig
+	errs   []ListenerError
+	closed bool
+	mu     sync.RWMutex
+	errMu  sync.Mutex
 }
 
 func NewEventManager() *EventManager {
+	return NewEventManagerWithConfig(DefaultEventManagerConfig)
+}
+
+func NewEventManagerWithConfig(c EventManagerConfig) *EventManager {
+	if c.QueueSize <= 0 {
+		c.QueueSize = DefaultEventManagerConfig.QueueSize
+	}
+	if c.Workers <= 0 {
+		c.Workers = DefaultEventManagerConfig.Workers
+	}
 	return &EventManager{
-		Listners: make([]EventListener, 0),
+		queues: make([]*listenerQueue, 0),
+		config: c,
 	}
 }
 
-func (e *EventManager) Subscribe(l EventListener) {
-	e.Listners = append(e.Listners, l)
+func (e *EventManager) Subscribe(l EventListener) error {
+	return e.SubscribeWithWorkers(l, e.config.Workers)
 }
 
-func (e *EventManager) ProcessEvent(message string) error {
-	newEvent := &Event{
-		message: message,
+// SubscribeWithWorkers starts workers goroutines that hand events to l. With
+// more than one worker, l must be safe for concurrent use and events may
+// reach it out of order. Listeners that are not comparable, such as func
+// adapters, are accepted but cannot be detected as duplicates or removed
+// with Unsubscribe.
+func (e *EventManager) SubscribeWithWorkers(l EventListener, workers int) error {
+	if workers <= 0 {
+		workers = 1
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return ErrEventManagerClosed
 	}
-	for _, l := range e.Listners {
-		l.OnEvent(newEvent)
+	if e.find(l) >= 0 {
+		return ErrAlreadySubscribed
+	}
+
+	q := &listenerQueue{
+		listener: l,
+		events:   make(chan *Event, e.config.QueueSize),
 	}
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go e.work(q)
+	}
+
+	e.queues = append(e.queues, q)
 	return nil
 }
+
+// Unsubscribe removes l. Events already queued for l are still delivered
+// before Unsubscribe returns.
+func (e *EventManager) Unsubscribe(l EventListener) {
+	e.mu.Lock()
+	i := e.find(l)
+	if i < 0 {
+		e.mu.Unlock()
+		return
+	}
+	q := e.queues[i]
+	queues := make([]*listenerQueue, 0, len(e.queues)-1)
+	queues = append(queues, e.queues[:i]...)
+	e.queues = append(queues, e.queues[i+1:]...)
+	close(q.events)
+	e.mu.Unlock()
+
+	q.wg.Wait()
+}
+
+// find returns the index of l's queue, or -1. Callers hold e.mu.
+func (e *EventManager) find(l EventListener) int {
+	for i, q := range e.queues {
+		if sameListener(q.listener, l) {
+			return i
+		}
+	}
+	return -1
+}
+
+// sameListener compares with == only when both values are comparable, since
+// == on interfaces panics for funcs, maps and slices.
+func sameListener(a, b EventListener) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Type() != vb.Type() || !va.Comparable() || !vb.Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// Listeners returns a snapshot of the subscribed listeners.
+func (e *EventManager) Listeners() []EventListener {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	listeners := make([]EventListener, 0, len(e.queues))
+	for _, q := range e.queues {
+		listeners = append(listeners, q.listener)
+	}
+	return listeners
+}
+
+func (e *EventManager) ProcessEvent(t EventType, message string, targetUsers ...string) error {
+	return e.Publish(NewEvent(t, message, targetUsers...))
+}
+
+// Publish queues the event for every listener and returns without waiting
+// for them. Listeners whose queue is full miss the event and are reported in
+// the returned error.
+func (e *EventManager) Publish(newEvent *Event) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.closed {
+		return ErrEventManagerClosed
+	}
+
+	var errs []error
+	for _, q := range e.queues {
+		select {
+		case q.events <- newEvent:
+		default:
+			errs = append(errs, ListenerError{Listener: q.listener, Event: newEvent, Err: ErrQueueFull})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (e *EventManager) work(q *listenerQueue) {
+	defer q.wg.Done()
+
+	for ev := range q.events {
+		if err := q.listener.OnEvent(ev); err != nil {
+			e.errMu.Lock()
+			e.errs = append(e.errs, ListenerError{Listener: q.listener, Event: ev, Err: err})
+			e.errMu.Unlock()
+		}
+	}
+}
+
+// Errors returns the listener failures collected so far.
+func (e *EventManager) Errors() []ListenerError {
+	e.errMu.Lock()
+	defer e.errMu.Unlock()
+	return append([]ListenerError(nil), e.errs...)
+}
+
+// Shutdown stops accepting events and waits for queued ones to be handled.
+// If ctx ends first the workers keep draining in the background and ctx's
+// error is returned.
+func (e *EventManager) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return nil
+	}
+	e.closed = true
+
+	queues := e.queues
+	for _, q := range queues {
+		close(q.events)
+	}
+	e.queues = nil
+	e.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		for _, q := range queues {
+			q.wg.Wait()
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type listenerFunc func(*Event) error
+
+func (f listenerFunc) OnEvent(e *Event) error { return f(e) }
+
+// sliceListener is a value type that holds a slice, so it is not comparable.
+type sliceListener struct {
+	got  *[]string
+	tags []string
+}
+
+func (l sliceListener) OnEvent(e *Event) error {
+	*l.got = append(*l.got, e.message)
+	return nil
+}
+
+type recordingListener struct {
+	mu  sync.Mutex
+	got []string
+}
+
+func (l *recordingListener) OnEvent(e *Event) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.got = append(l.got, e.message)
+	return nil
+}
+
+func shutdown(t *testing.T, e *EventManager) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+}
+
+func TestSubscribeUncomparableListeners(t *testing.T) {
+	e := NewEventManager()
+
+	var mu sync.Mutex
+	var fromFunc []string
+	fn := listenerFunc(func(ev *Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		fromFunc = append(fromFunc, ev.message)
+		return nil
+	})
+	var fromSlice []string
+	sl := sliceListener{got: &fromSlice, tags: []string{"audit"}}
+
+	if err := e.Subscribe(fn); err != nil {
+		t.Fatalf("Subscribe func: %v", err)
+	}
+	if err := e.Subscribe(sl); err != nil {
+		t.Fatalf("Subscribe slice struct: %v", err)
+	}
+	// neither can be matched, so these are no-ops rather than panics
+	e.Unsubscribe(fn)
+	e.Unsubscribe(sl)
+
+	if err := e.ProcessEvent(ORDER_UPDATE, "shipped"); err != nil {
+		t.Fatalf("ProcessEvent: %v", err)
+	}
+	shutdown(t, e)
+
+	if len(fromFunc) != 1 || fromFunc[0] != "shipped" {
+		t.Errorf("func listener got %v", fromFunc)
+	}
+	if len(fromSlice) != 1 || fromSlice[0] != "shipped" {
+		t.Errorf("slice listener got %v", fromSlice)
+	}
+}
+
+func TestSubscribeTwiceAndUnsubscribe(t *testing.T) {
+	e := NewEventManager()
+	l := &recordingListener{}
+
+	if err := e.Subscribe(l); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Subscribe(l); !errors.Is(err, ErrAlreadySubscribed) {
+		t.Fatalf("second Subscribe: err = %v, want ErrAlreadySubscribed", err)
+	}
+
+	e.ProcessEvent(ORDER_UPDATE, "first")
+	e.Unsubscribe(l)
+	e.ProcessEvent(ORDER_UPDATE, "second")
+	shutdown(t, e)
+
+	if len(l.got) != 1 || l.got[0] != "first" {
+		t.Errorf("listener got %v, want only the event before Unsubscribe", l.got)
+	}
+	if n := len(e.Listeners()); n != 0 {
+		t.Errorf("%d listeners left after Unsubscribe", n)
+	}
+}
+
+func TestUnsubscribeAfterShutdown(t *testing.T) {
+	e := NewEventManager()
+	l := &recordingListener{}
+	if err := e.Subscribe(l); err != nil {
+		t.Fatal(err)
+	}
+	shutdown(t, e)
+
+	// used to close the listener's queue a second time and panic
+	e.Unsubscribe(l)
+
+	if err := e.Subscribe(l); !errors.Is(err, ErrEventManagerClosed) {
+		t.Errorf("Subscribe after Shutdown: err = %v, want ErrEventManagerClosed", err)
+	}
+	if err := e.ProcessEvent(ORDER_UPDATE, "late"); !errors.Is(err, ErrEventManagerClosed) {
+		t.Errorf("ProcessEvent after Shutdown: err = %v, want ErrEventManagerClosed", err)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type CapturedMail struct {
+	From     string
+	To       []string
+	Data     []byte
+	TLS      bool
+	AuthUser string
+}
+
+// FakeSMTPServer is a minimal in-process SMTP server. It offers STARTTLS
+// with a self-signed certificate unless disabled, accepts AUTH PLAIN for one
+// user and captures every message instead of relaying it.
+type FakeSMTPServer struct {
+	Addr     string
+	RootCAs  *x509.CertPool // trusts the server's certificate
+	username string         // empty allows MAIL without AUTH
+	password string
+	tls      *tls.Config // nil means STARTTLS is not offered
+	ln       net.Listener
+	messages []CapturedMail
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+}
+
+// NewFakeSMTPServer starts a server that is closed when the test ends.
+func NewFakeSMTPServer(t *testing.T, username, password string, startTLS bool) *FakeSMTPServer {
+	t.Helper()
+
+	cert, pool, err := selfSignedCert("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &FakeSMTPServer{
+		Addr:     ln.Addr().String(),
+		RootCAs:  pool,
+		username: username,
+		password: password,
+		ln:       ln,
+		messages: make([]CapturedMail, 0),
+	}
+	if startTLS {
+		s.tls = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	s.wg.Add(1)
+	go s.serve()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Settings returns SMTPSettings pointing at the server and trusting its
+// certificate.
+func (s *FakeSMTPServer) Settings() *SMTPSettings {
+	host, port, _ := net.SplitHostPort(s.Addr)
+	p, _ := strconv.Atoi(port)
+	return &SMTPSettings{
+		Host:       host,
+		Port:       p,
+		Username:   s.username,
+		Password:   s.password,
+		From:       "alerts@shop.example",
+		RequireTLS: true,
+		TLSConfig:  &tls.Config{RootCAs: s.RootCAs},
+		Timeout:    2 * time.Second,
+	}
+}
+
+func (s *FakeSMTPServer) Messages() []CapturedMail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]CapturedMail(nil), s.messages...)
+}
+
+func (s *FakeSMTPServer) Close() {
+	s.ln.Close()
+	s.wg.Wait()
+}
+
+func (s *FakeSMTPServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *FakeSMTPServer) handle(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 fake.smtp ESMTP ready")
+
+	var mail CapturedMail
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			if s.tls != nil && !mail.TLS {
+				tp.PrintfLine("250-fake.smtp\r\n250-STARTTLS\r\n250 8BITMIME")
+			} else {
+				tp.PrintfLine("250-fake.smtp\r\n250-AUTH PLAIN\r\n250 8BITMIME")
+			}
+		case "STARTTLS":
+			if s.tls == nil || mail.TLS {
+				tp.PrintfLine("502 Command not implemented")
+				continue
+			}
+			tp.PrintfLine("220 Ready to start TLS")
+			tlsConn := tls.Server(conn, s.tls)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			tp = textproto.NewConn(conn)
+			mail = CapturedMail{TLS: true}
+		case "AUTH":
+			mech, initial, _ := strings.Cut(arg, " ")
+			if (s.tls != nil && !mail.TLS) || !strings.EqualFold(mech, "PLAIN") {
+				tp.PrintfLine("504 Unrecognized authentication type")
+				continue
+			}
+			decoded, err := base64.StdEncoding.DecodeString(initial)
+			parts := strings.Split(string(decoded), "\x00")
+			if err != nil || len(parts) != 3 || parts[1] != s.username || parts[2] != s.password {
+				tp.PrintfLine("535 Authentication credentials invalid")
+				continue
+			}
+			mail.AuthUser = parts[1]
+			tp.PrintfLine("235 Authentication successful")
+		case "MAIL":
+			if s.username != "" && mail.AuthUser == "" {
+				tp.PrintfLine("530 Authentication required")
+				continue
+			}
+			mail.From = addressArg(arg)
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			mail.To = append(mail.To, addressArg(arg))
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			mail.Data = data
+			s.mu.Lock()
+			s.messages = append(s.messages, mail)
+			s.mu.Unlock()
+			mail = CapturedMail{TLS: mail.TLS, AuthUser: mail.AuthUser}
+			tp.PrintfLine("250 OK: queued")
+		case "RSET", "NOOP":
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+// addressArg pulls the address out of "FROM:<a@b>" or "TO:<a@b>".
+func addressArg(arg string) string {
+	_, addr, _ := strings.Cut(arg, ":")
+	addr, _, _ = strings.Cut(strings.TrimSpace(addr), " ")
+	return strings.Trim(addr, "<>")
+}
+
+func selfSignedCert(host string) (tls.Certificate, *x509.CertPool, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		IPAddresses:  []net.IP{net.ParseIP(host)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool, nil
+}
@@ -1,19 +1,134 @@
 package main
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
 func main() {
 	userService := NewUserService()
 
 	user1, user2 := userService.Create(), userService.Create()
-	userService.AddPreference(user1, "EMAIL")
-	userService.AddPreference(user1, "SMS")
+	userService.SubscribeWithFallback(user1, ORDER_UPDATE,
+		ChannelPreference{Channel: EMAIL, MaxAttempts: 1},
+		ChannelPreference{Channel: SMS},
+		ChannelPreference{Channel: PUSH},
+	)
+	userService.Subscribe(user1, SECURITY_ALERT, WEBHOOK, SMS)
+
+	userService.Subscribe(user2, ORDER_UPDATE, SMS)
+	userService.AddPreference(user2, PROMOTION, EMAIL)
 
-	userService.AddPreference(user2, "SMS")
+	userService.SetLocale(user2, "es-MX")
+	userService.SetContact(user1, EMAIL, "asha@example.com")
+	userService.SetContact(user2, EMAIL, "diego@example.com")
+
+	// Email goes to SMTP when SMTP_HOST is set and to stdout otherwise. user1
+	// has no webhook URL, so security alerts fall back to SMS.
 
 	notificationService := NewNotificationService(userService)
 	notificationListener := NewNotificationListener(notificationService)
 
-	eventMgr := NewEventManager()
+	templates := notificationService.Templates()
+	registrations := []struct {
+		key  TemplateKey
+		tmpl MessageTemplate
+	}{
+		{TemplateKey{ORDER_UPDATE, EMAIL, "en"}, MessageTemplate{
+			Subject: "Order {{.orderId}} is {{.status}}",
+			Body:    "<p>Hi {{.name}}, order <b>{{.orderId}}</b> is {{.status}}.</p>",
+		}},
+		{TemplateKey{ORDER_UPDATE, SMS, "en"}, MessageTemplate{Body: "Order {{.orderId}}: {{.status}}"}},
+		{TemplateKey{ORDER_UPDATE, SMS, "es"}, MessageTemplate{Body: "Pedido {{.orderId}}: {{.status}}"}},
+		{TemplateKey{PROMOTION, EMAIL, "en"}, MessageTemplate{
+			Subject: "{{.offer}}",
+			Body:    "<p>{{.name}}, use code {{.code}} at checkout.</p>",
+		}},
+		{TemplateKey{SECURITY_ALERT, SMS, "en"}, MessageTemplate{Body: "New login from {{.device}} in {{.location}}"}},
+		{TemplateKey{SECURITY_ALERT, WEBHOOK, "en"}, MessageTemplate{Body: "New login from {{.device}} in {{.location}}"}},
+		// fails: SECURITY_ALERT events carry no ip
+		{TemplateKey{SECURITY_ALERT, EMAIL, "en"}, MessageTemplate{Subject: "New login", Body: "<p>Login from {{.ip}}</p>"}},
+	}
+	for _, r := range registrations {
+		if err := templates.Register(r.key, r.tmpl); err != nil {
+			fmt.Println("register:", err)
+		}
+	}
+
+	// SMS gateway drops the first two requests; email is down until repaired,
+	// so order updates fall back to SMS.
+	dispatcher := notificationService.Dispatcher()
+	dispatcher.SetRetryPolicy(SMS, RetryPolicy{MaxAttempts: 3, BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond, Jitter: 0.2})
+	dispatcher.SetRetryPolicy(EMAIL, RetryPolicy{MaxAttempts: 2, BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond})
+	dispatcher.SetRetryPolicy(WEBHOOK, RetryPolicy{MaxAttempts: 3, BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond, Jitter: 0.2})
+	dispatcher.SetChannel(SMS, &flakyChannel{channel: &SmsChannel{}, failures: 2})
+	email := &flakyChannel{channel: GetChannel(EMAIL), failures: -1}
+	dispatcher.SetChannel(EMAIL, email)
+
+	eventMgr := NewEventManagerWithConfig(EventManagerConfig{QueueSize: 16, Workers: 2})
 	eventMgr.Subscribe(notificationListener)
 
-	eventMgr.ProcessEvent("is it happening?")
+	eventMgr.Publish(NewEvent(ORDER_UPDATE, "your order is on the way", user1.id, user2.id).WithPayload(map[string]any{
+		"name": "Asha", "orderId": "OD-1042", "status": "out for delivery",
+	}))
+	eventMgr.Publish(NewEvent(PROMOTION, "50% off this weekend").WithPayload(map[string]any{
+		"name": "<friend>", "offer": "50% off this weekend", "code": "HALF50",
+	}))
+	eventMgr.Publish(NewEvent(SECURITY_ALERT, "new login", user1.id, user2.id).WithPayload(map[string]any{
+		"name": "Asha", "device": "Chrome on Linux", "location": "Pune",
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := eventMgr.Shutdown(ctx); err != nil {
+		fmt.Println("shutdown:", err)
+	}
+	for _, err := range eventMgr.Errors() {
+		fmt.Println(err)
+	}
+
+	letters := dispatcher.DeadLetters().List()
+	for _, letter := range letters {
+		fmt.Printf("dead letter %s: %s to %s after %d attempts: %v\n",
+			letter.Id, letter.Channel, letter.Notification.userId, letter.Attempts, letter.Err)
+	}
+	email.repair()
+	if err := dispatcher.ReplayAll(); err != nil {
+		fmt.Println("replay:", err)
+	}
+	for _, r := range dispatcher.Deliveries() {
+		fmt.Printf("%s (%s) to %s delivered via %s after %d attempts\n",
+			r.NotificationId, r.EventType, r.UserId, r.Channel, r.Attempts)
+	}
+	fmt.Println("dead letters left:", dispatcher.DeadLetters().Len())
+}
+
+// flakyChannel fails the first failures sends, or every send while failures
+// is negative.
+type flakyChannel struct {
+	channel  NotificationChannel
+	failures int
+	mu       sync.Mutex
+}
+
+func (c *flakyChannel) Send(n *Notification) error {
+	c.mu.Lock()
+	if c.failures != 0 {
+		if c.failures > 0 {
+			c.failures--
+		}
+		c.mu.Unlock()
+		return errors.New("Gateway unavailable")
+	}
+	c.mu.Unlock()
+	return c.channel.Send(n)
+}
+
+func (c *flakyChannel) repair() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures = 0
 }
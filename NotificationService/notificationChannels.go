@@ -1,21 +1,51 @@
 package main
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrNoAddress = errors.New("User has no address for channel")
 
 type NotificationChannel interface {
 	Send(n *Notification) error
 }
 
-type EmailChannel struct{}
+// EmailChannel sends through SMTP, or prints to stdout when no SMTP server
+// is configured.
+type EmailChannel struct {
+	smtp *SMTPSettings
+}
+
+func NewEmailChannel(s *SMTPSettings) *EmailChannel {
+	return &EmailChannel{
+		smtp: s,
+	}
+}
 
 func (e *EmailChannel) Send(n *Notification) error {
-	fmt.Println("Sending email to user: ", n)
+	msg := n.content(EMAIL)
+	if e.smtp != nil {
+		to := n.address(EMAIL)
+		if to == "" {
+			return Permanent(ErrNoAddress)
+		}
+		return sendSMTP(e.smtp, to, msg)
+	}
+	fmt.Printf("Sending email to user: %s\n  Subject: %s\n  %s\n", n.userId, msg.Subject, msg.Body)
 	return nil
 }
 
 type SmsChannel struct{}
 
 func (e *SmsChannel) Send(n *Notification) error {
-	fmt.Println("Sending sms to user: ", n)
+	fmt.Printf("Sending sms to user: %s: %s\n", n.userId, n.content(SMS).Body)
+	return nil
+}
+
+type PushChannel struct{}
+
+func (e *PushChannel) Send(n *Notification) error {
+	fmt.Printf("Sending push to user: %s: %s\n", n.userId, n.content(PUSH).Body)
 	return nil
 }
@@ -1,30 +1,141 @@
 package main
 
+import (
+	"errors"
+	"fmt"
+	"html"
+	"sync/atomic"
+)
+
 type Notification struct {
-	message string
+	id           string
+	userId       string
+	eventType    EventType
+	message      string
+	rendered     map[ChannelType]*RenderedMessage
+	contacts     map[ChannelType]string
+	deliveredVia ChannelType // set once a channel accepts it
+}
+
+func (n *Notification) Id() string {
+	return n.id
+}
+
+func (n *Notification) DeliveredVia() ChannelType {
+	return n.deliveredVia
+}
+
+func (n *Notification) address(c ChannelType) string {
+	return n.contacts[c]
+}
+
+// content returns what channel c should send: its rendered template, or the
+// raw event message when no template was registered. Email bodies are HTML,
+// so the raw message is escaped for them.
+func (n *Notification) content(c ChannelType) *RenderedMessage {
+	if msg, ok := n.rendered[c]; ok {
+		return msg
+	}
+	body := n.message
+	if c == EMAIL {
+		body = html.EscapeString(body)
+	}
+	return &RenderedMessage{Subject: string(n.eventType), Body: body}
 }
 
 type NotificationService struct {
 	userService *UserService
+	dispatcher  *Dispatcher
+	templates   *TemplateRegistry
+	seq         atomic.Int64
 }
 
 func NewNotificationService(u *UserService) *NotificationService {
 	return &NotificationService{
 		userService: u,
+		dispatcher:  NewDispatcher(),
+		templates:   NewTemplateRegistry(),
+	}
+}
+
+func (s *NotificationService) Templates() *TemplateRegistry {
+	return s.templates
+}
+
+func (s *NotificationService) Dispatcher() *Dispatcher {
+	return s.dispatcher
+}
+
+// Notify sends e to its target users, or to every user when it has none,
+// walking each user's fallback chain for e's event type until one channel
+// delivers. Users who did not subscribe to the event type are skipped.
+// Each channel's message is rendered from its template in the user's locale;
+// a channel whose template fails to render is dropped from the chain. Users
+// no channel could reach are dead-lettered by the dispatcher and their errors
+// returned together.
+func (s *NotificationService) Notify(e *Event) error {
+	var errs []error
+	for _, u := range s.recipients(e) {
+		newNotif := &Notification{
+			id:        fmt.Sprintf("N%08d", s.seq.Add(1)),
+			userId:    u.id,
+			eventType: e.eventType,
+			message:   e.message,
+			rendered:  make(map[ChannelType]*RenderedMessage),
+			contacts:  s.userService.Contacts(u),
+		}
+
+		chain := s.userService.FallbackChain(u, e.eventType)
+		if len(chain) == 0 {
+			continue
+		}
+		chain, err := s.render(newNotif, chain, s.userService.Locale(u), e.payload)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if len(chain) == 0 {
+			continue
+		}
+		if err := s.dispatcher.DeliverWithFallback(newNotif, chain); err != nil {
+			errs = append(errs, err)
+		}
 	}
+	return errors.Join(errs...)
 }
 
-func (s *NotificationService) Notify(e *Event) {
-	newNotif := &Notification{
-		message: e.message,
+func (s *NotificationService) render(n *Notification, chain []ChannelPreference, locale string, payload map[string]any) ([]ChannelPreference, error) {
+	usable := make([]ChannelPreference, 0, len(chain))
+	var errs []error
+	for _, pref := range chain {
+		msg, err := s.templates.Render(n.eventType, pref.Channel, locale, payload)
+		switch {
+		case errors.Is(err, ErrTemplateNotFound):
+		case err != nil:
+			errs = append(errs, fmt.Errorf("%s template for %s: %w", pref.Channel, n.userId, err))
+			continue
+		default:
+			n.rendered[pref.Channel] = msg
+		}
+		usable = append(usable, pref)
 	}
+	return usable, errors.Join(errs...)
+}
 
-	for _, u := range s.userService.GetAll() {
-		preferences := u.notificationPreferences
+func (s *NotificationService) recipients(e *Event) []*User {
+	if len(e.targetUsers) == 0 {
+		all := s.userService.GetAll()
+		users := make([]*User, 0, len(all))
+		for _, u := range all {
+			users = append(users, u)
+		}
+		return users
+	}
 
-		for _, pref := range preferences {
-			channel := GetChannel(pref)
-			channel.Send(newNotif)
+	users := make([]*User, 0, len(e.targetUsers))
+	for _, id := range e.targetUsers {
+		if u := s.userService.Get(id); u != nil {
+			users = append(users, u)
 		}
 	}
+	return users
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/tls"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type SMTPSettings struct {
+	Host       string
+	Port       int
+	Username   string // empty skips AUTH
+	Password   string
+	From       string
+	RequireTLS bool        // refuse to send if the server does not offer STARTTLS
+	TLSConfig  *tls.Config // nil verifies the server against the system roots
+	Timeout    time.Duration
+}
+
+// Settings configures the channels GetChannel builds.
+type Settings struct {
+	SMTP    *SMTPSettings // nil prints email to stdout
+	Webhook WebhookSettings
+}
+
+var (
+	settings   = LoadSettings()
+	settingsMu sync.RWMutex
+)
+
+// LoadSettings reads channel settings from the environment. SMTP is enabled
+// when SMTP_HOST is set.
+func LoadSettings() Settings {
+	s := Settings{
+		Webhook: WebhookSettings{
+			Secret:  os.Getenv("WEBHOOK_SECRET"),
+			Timeout: 5 * time.Second,
+		},
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("WEBHOOK_TIMEOUT")); err == nil {
+		s.Webhook.Timeout = timeout
+	}
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		port, err := strconv.Atoi(os.Getenv("SMTP_PORT"))
+		if err != nil {
+			port = 587
+		}
+		s.SMTP = &SMTPSettings{
+			Host:       host,
+			Port:       port,
+			Username:   os.Getenv("SMTP_USERNAME"),
+			Password:   os.Getenv("SMTP_PASSWORD"),
+			From:       os.Getenv("SMTP_FROM"),
+			RequireTLS: os.Getenv("SMTP_REQUIRE_TLS") != "false",
+			Timeout:    10 * time.Second,
+		}
+	}
+	return s
+}
+
+func SetSettings(s Settings) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	settings = s
+}
+
+func CurrentSettings() Settings {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return settings
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"html"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrStartTLSUnsupported = errors.New("SMTP server does not support STARTTLS")
+	ErrInvalidAddress      = errors.New("Invalid email address")
+)
+
+// sendSMTP delivers one message over a fresh connection: STARTTLS when
+// offered, AUTH when credentials are set, then a multipart/alternative body.
+// 5xx replies are permanent; anything else may succeed on retry.
+func sendSMTP(cfg *SMTPSettings, to string, msg *RenderedMessage) error {
+	fromAddr, err := parseAddress(cfg.From)
+	if err != nil {
+		return Permanent(err)
+	}
+	toAddr, err := parseAddress(to)
+	if err != nil {
+		return Permanent(err)
+	}
+	data, err := buildMIMEMessage(fromAddr, toAddr, msg)
+	if err != nil {
+		return Permanent(err)
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)), timeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	c, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return classifySMTPError(err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		tlsConfig := cfg.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		tlsConfig = tlsConfig.Clone()
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = cfg.Host
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return classifySMTPError(err)
+		}
+	} else if cfg.RequireTLS {
+		return Permanent(ErrStartTLSUnsupported)
+	}
+
+	if cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return classifySMTPError(err)
+		}
+	}
+
+	if err := c.Mail(fromAddr.Address); err != nil {
+		return classifySMTPError(err)
+	}
+	if err := c.Rcpt(toAddr.Address); err != nil {
+		return classifySMTPError(err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return classifySMTPError(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return classifySMTPError(err)
+	}
+	return classifySMTPError(c.Quit())
+}
+
+// parseAddress rejects anything that is not a single RFC 5322 address, so
+// user supplied contact data cannot smuggle extra header lines in.
+func parseAddress(s string) (*mail.Address, error) {
+	if strings.ContainsAny(s, "\r\n") {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidAddress, s)
+	}
+	addr, err := mail.ParseAddress(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q: %v", ErrInvalidAddress, s, err)
+	}
+	return addr, nil
+}
+
+func classifySMTPError(err error) error {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) && protoErr.Code >= 500 {
+		return Permanent(err)
+	}
+	return err
+}
+
+// buildMIMEMessage renders msg as multipart/alternative with a plain text
+// part derived from the HTML body.
+func buildMIMEMessage(from, to *mail.Address, msg *RenderedMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	headers := []struct{ key, value string }{
+		{"From", from.String()},
+		{"To", to.String()},
+		{"Subject", mime.QEncoding.Encode("utf-8", msg.Subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", messageId(from.Address)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + mw.Boundary()},
+	}
+	for _, h := range headers {
+		fmt.Fprintf(&buf, "%s: %s\r\n", h.key, h.value)
+	}
+	buf.WriteString("\r\n")
+
+	parts := []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", htmlToText(msg.Body)},
+		{"text/html; charset=utf-8", msg.Body},
+	}
+	for _, p := range parts {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(pw)
+		if _, err := qw.Write([]byte(p.body)); err != nil {
+			return nil, err
+		}
+		if err := qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var (
+	breakTags = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>|</li>`)
+	anyTag    = regexp.MustCompile(`<[^>]*>`)
+)
+
+func htmlToText(body string) string {
+	text := breakTags.ReplaceAllString(body, "\n")
+	text = anyTag.ReplaceAllString(text, "")
+	return strings.TrimSpace(html.UnescapeString(text))
+}
+
+func messageId(from string) string {
+	domain := "localhost"
+	if _, d, found := strings.Cut(from, "@"); found {
+		domain = strings.Trim(d, "> ")
+	}
+	b := make([]byte, 12)
+	rand.Read(b)
+	return fmt.Sprintf("<%x@%s>", b, domain)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+var testEmail = &RenderedMessage{
+	Subject: "Order OD-1042 shipped",
+	Body:    "<p>Hi Asha, order <b>OD-1042</b> is on its way.</p>",
+}
+
+func TestSendSMTPUpgradesToTLSAndAuthenticates(t *testing.T) {
+	srv := NewFakeSMTPServer(t, "notifier", "s3cret", true)
+
+	if err := sendSMTP(srv.Settings(), "asha@example.com", testEmail); err != nil {
+		t.Fatalf("sendSMTP: %v", err)
+	}
+
+	msgs := srv.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("captured %d messages, want 1", len(msgs))
+	}
+	got := msgs[0]
+	if !got.TLS {
+		t.Error("message was not sent over STARTTLS")
+	}
+	if got.AuthUser != "notifier" {
+		t.Errorf("AuthUser = %q, want notifier", got.AuthUser)
+	}
+	if got.From != "alerts@shop.example" || len(got.To) != 1 || got.To[0] != "asha@example.com" {
+		t.Errorf("envelope = %s -> %v", got.From, got.To)
+	}
+}
+
+func TestSendSMTPBadCredentialsArePermanent(t *testing.T) {
+	srv := NewFakeSMTPServer(t, "notifier", "s3cret", true)
+	cfg := srv.Settings()
+	cfg.Password = "wrong"
+
+	err := sendSMTP(cfg, "asha@example.com", testEmail)
+	if err == nil {
+		t.Fatal("sendSMTP succeeded with a wrong password")
+	}
+	if !strings.Contains(err.Error(), "535") {
+		t.Errorf("err = %v, want a 535 reply", err)
+	}
+	if !isPermanent(err) {
+		t.Errorf("535 should be permanent, got %v", err)
+	}
+	if n := len(srv.Messages()); n != 0 {
+		t.Errorf("captured %d messages, want 0", n)
+	}
+}
+
+func TestSendSMTPRequireTLS(t *testing.T) {
+	srv := NewFakeSMTPServer(t, "", "", false)
+
+	cfg := srv.Settings()
+	err := sendSMTP(cfg, "asha@example.com", testEmail)
+	if !errors.Is(err, ErrStartTLSUnsupported) || !isPermanent(err) {
+		t.Fatalf("err = %v, want permanent ErrStartTLSUnsupported", err)
+	}
+	if n := len(srv.Messages()); n != 0 {
+		t.Fatalf("captured %d messages before TLS check, want 0", n)
+	}
+
+	cfg.RequireTLS = false
+	if err := sendSMTP(cfg, "asha@example.com", testEmail); err != nil {
+		t.Fatalf("plaintext send with RequireTLS off: %v", err)
+	}
+	if msgs := srv.Messages(); len(msgs) != 1 || msgs[0].TLS {
+		t.Fatalf("messages = %+v, want one plaintext message", msgs)
+	}
+}
+
+func TestSendSMTPMultipartAlternative(t *testing.T) {
+	srv := NewFakeSMTPServer(t, "notifier", "s3cret", true)
+
+	if err := sendSMTP(srv.Settings(), "Asha <asha@example.com>", testEmail); err != nil {
+		t.Fatalf("sendSMTP: %v", err)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(srv.Messages()[0].Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if subject != testEmail.Subject {
+		t.Errorf("Subject = %q, want %q", subject, testEmail.Subject)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, want multipart/alternative", msg.Header.Get("Content-Type"))
+	}
+
+	parts := make(map[string]string)
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(part) // NextPart decodes quoted-printable
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		parts[contentType] = string(body)
+	}
+
+	if got, want := parts["text/plain"], "Hi Asha, order OD-1042 is on its way."; got != want {
+		t.Errorf("text/plain = %q, want %q", got, want)
+	}
+	if got := parts["text/html"]; got != testEmail.Body {
+		t.Errorf("text/html = %q, want %q", got, testEmail.Body)
+	}
+}
+
+func TestSendSMTPRejectsHeaderInjection(t *testing.T) {
+	srv := NewFakeSMTPServer(t, "notifier", "s3cret", true)
+
+	for _, to := range []string{
+		"asha@example.com\r\nBcc: mallory@example.com",
+		"asha@example.com\nBcc: mallory@example.com",
+		"not an address",
+	} {
+		err := sendSMTP(srv.Settings(), to, testEmail)
+		if !errors.Is(err, ErrInvalidAddress) || !isPermanent(err) {
+			t.Errorf("to %q: err = %v, want permanent ErrInvalidAddress", to, err)
+		}
+	}
+	if n := len(srv.Messages()); n != 0 {
+		t.Errorf("captured %d messages, want 0", n)
+	}
+}
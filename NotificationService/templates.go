@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+)
+
+const DefaultLocale = "en"
+
+var ErrTemplateNotFound = errors.New("Template not found")
+
+// EventVariables lists the payload keys each event type carries. Templates
+// may only reference these.
+var EventVariables = map[EventType][]string{
+	ORDER_UPDATE:   {"name", "orderId", "status"},
+	PROMOTION:      {"name", "offer", "code"},
+	SECURITY_ALERT: {"name", "device", "location"},
+}
+
+type TemplateKey struct {
+	EventType EventType
+	Channel   ChannelType
+	Locale    string
+}
+
+// MessageTemplate is the source of a template. Subject is only used for
+// email.
+type MessageTemplate struct {
+	Subject string
+	Body    string
+}
+
+type RenderedMessage struct {
+	Subject string
+	Body    string
+}
+
+type executor interface {
+	Execute(w *bytes.Buffer, data any) error
+}
+
+type textExecutor struct{ t *template.Template }
+
+func (e textExecutor) Execute(w *bytes.Buffer, data any) error { return e.t.Execute(w, data) }
+
+type htmlExecutor struct{ t *htmltemplate.Template }
+
+func (e htmlExecutor) Execute(w *bytes.Buffer, data any) error { return e.t.Execute(w, data) }
+
+type compiledTemplate struct {
+	subject executor
+	body    executor
+}
+
+// TemplateRegistry holds one template per event type, channel and locale.
+// Email bodies are HTML templates so payload values are escaped; every other
+// channel gets plain text.
+type TemplateRegistry struct {
+	templates map[TemplateKey]*compiledTemplate
+	variables map[EventType]map[string]bool
+	mu        sync.RWMutex
+}
+
+func NewTemplateRegistry() *TemplateRegistry {
+	r := &TemplateRegistry{
+		templates: make(map[TemplateKey]*compiledTemplate),
+		variables: make(map[EventType]map[string]bool),
+	}
+	for t, vars := range EventVariables {
+		r.DeclareVariables(t, vars...)
+	}
+	return r
+}
+
+// DeclareVariables adds payload keys that templates for t may use.
+func (r *TemplateRegistry) DeclareVariables(t EventType, vars ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.variables[t] == nil {
+		r.variables[t] = make(map[string]bool)
+	}
+	for _, v := range vars {
+		r.variables[t][v] = true
+	}
+}
+
+// Register parses tmpl and stores it under key. It fails if the template
+// does not parse or uses a variable the event type does not declare.
+func (r *TemplateRegistry) Register(key TemplateKey, tmpl MessageTemplate) error {
+	if key.Locale == "" {
+		key.Locale = DefaultLocale
+	}
+	if tmpl.Body == "" {
+		return fmt.Errorf("Template %v has no body", key)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	compiled := &compiledTemplate{}
+	var err error
+	if compiled.body, err = r.compile(key, "body", tmpl.Body); err != nil {
+		return err
+	}
+	if key.Channel == EMAIL {
+		if tmpl.Subject == "" {
+			return fmt.Errorf("Email template %v has no subject", key)
+		}
+		// Subjects are headers, not HTML, so they stay plain text.
+		t, err := r.parseText(key, "subject", tmpl.Subject)
+		if err != nil {
+			return err
+		}
+		compiled.subject = textExecutor{t}
+	}
+
+	r.templates[key] = compiled
+	return nil
+}
+
+func (r *TemplateRegistry) compile(key TemplateKey, part, src string) (executor, error) {
+	t, err := r.parseText(key, part, src)
+	if err != nil {
+		return nil, err
+	}
+	if key.Channel != EMAIL {
+		return textExecutor{t}, nil
+	}
+
+	h, err := htmltemplate.New(part).Option("missingkey=error").Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("Template %v %s: %w", key, part, err)
+	}
+	return htmlExecutor{h}, nil
+}
+
+// parseText parses src and checks its variables against the event type.
+func (r *TemplateRegistry) parseText(key TemplateKey, part, src string) (*template.Template, error) {
+	t, err := template.New(part).Option("missingkey=error").Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("Template %v %s: %w", key, part, err)
+	}
+
+	declared := r.variables[key.EventType]
+	for _, v := range templateVariables(t.Tree.Root) {
+		if !declared[v] {
+			return nil, fmt.Errorf("Template %v %s uses undeclared variable %q", key, part, v)
+		}
+	}
+	return t, nil
+}
+
+// Render fills in the template for t and c with payload. It looks for locale,
+// then its base language, then DefaultLocale.
+func (r *TemplateRegistry) Render(t EventType, c ChannelType, locale string, payload map[string]any) (*RenderedMessage, error) {
+	compiled, ok := r.lookup(t, c, locale)
+	if !ok {
+		return nil, ErrTemplateNotFound
+	}
+
+	msg := &RenderedMessage{}
+	var buf bytes.Buffer
+	if compiled.subject != nil {
+		if err := compiled.subject.Execute(&buf, payload); err != nil {
+			return nil, err
+		}
+		msg.Subject = buf.String()
+		buf.Reset()
+	}
+	if err := compiled.body.Execute(&buf, payload); err != nil {
+		return nil, err
+	}
+	msg.Body = buf.String()
+	return msg, nil
+}
+
+func (r *TemplateRegistry) lookup(t EventType, c ChannelType, locale string) (*compiledTemplate, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	candidates := []string{locale}
+	if base, _, found := strings.Cut(locale, "-"); found {
+		candidates = append(candidates, base)
+	}
+	candidates = append(candidates, DefaultLocale)
+
+	for _, l := range candidates {
+		if compiled, ok := r.templates[TemplateKey{EventType: t, Channel: c, Locale: l}]; ok {
+			return compiled, true
+		}
+	}
+	return nil, false
+}
+
+// templateVariables returns the top-level payload keys a template reads,
+// whether through dot or through $. Fields inside range and with blocks are
+// relative to a new dot and skipped, but $ still refers to the payload there.
+func templateVariables(root parse.Node) []string {
+	vars := make([]string, 0)
+	var walk func(n parse.Node, atRoot bool)
+	walk = func(n parse.Node, atRoot bool) {
+		switch n := n.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child, atRoot)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe, atRoot)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				walk(cmd, atRoot)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg, atRoot)
+			}
+		case *parse.FieldNode:
+			if atRoot {
+				vars = append(vars, n.Ident[0])
+			}
+		case *parse.VariableNode:
+			if n.Ident[0] == "$" && len(n.Ident) > 1 {
+				vars = append(vars, n.Ident[1])
+			}
+		case *parse.ChainNode:
+			// ($).key and (.).key read key from the payload itself
+			operand := n.Node
+			if p, ok := operand.(*parse.PipeNode); ok && len(p.Decl) == 0 && len(p.Cmds) == 1 && len(p.Cmds[0].Args) == 1 {
+				operand = p.Cmds[0].Args[0]
+			}
+			switch operand := operand.(type) {
+			case *parse.VariableNode:
+				if len(operand.Ident) == 1 && operand.Ident[0] == "$" {
+					vars = append(vars, n.Field[0])
+				}
+			case *parse.DotNode:
+				if atRoot {
+					vars = append(vars, n.Field[0])
+				}
+			default:
+				walk(operand, atRoot)
+			}
+		case *parse.IfNode:
+			walk(n.Pipe, atRoot)
+			walk(n.List, atRoot)
+			walk(n.ElseList, atRoot)
+		case *parse.RangeNode:
+			walk(n.Pipe, atRoot)
+			walk(n.List, false)
+			walk(n.ElseList, atRoot)
+		case *parse.WithNode:
+			walk(n.Pipe, atRoot)
+			walk(n.List, false)
+			walk(n.ElseList, atRoot)
+		case *parse.TemplateNode:
+			walk(n.Pipe, atRoot)
+		}
+	}
+	walk(root, true)
+	return vars
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegisterChecksVariables(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		invalid string // undeclared variable Register must report, "" if valid
+	}{
+		{"field", "from {{.device}}", ""},
+		{"undeclared field", "from {{.ip}}", "ip"},
+		{"root variable", "from {{$.device}}", ""},
+		{"undeclared root variable", "from {{$.ip}}", "ip"},
+		{"chained field", "{{.name.first}}", ""},
+		{"undeclared chain on root", "{{($).ip}}", "ip"},
+		{"undeclared chain on pipeline", "{{(.ip).city}}", "ip"},
+		{"undeclared in if", "{{if .device}}{{.ip}}{{end}}", "ip"},
+		{"range body fields are relative", "{{range .device}}{{.ip}}{{end}}", ""},
+		{"undeclared root variable in range", "{{range .device}}{{$.ip}}{{end}}", "ip"},
+		{"undeclared root variable in with", "{{with .location}}{{$.ip}}{{end}}", "ip"},
+		{"declared root variable in with", "{{with .location}}{{.}} for {{$.name}}{{end}}", ""},
+		{"local variable", "{{$d := .device}}{{$d}}", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewTemplateRegistry()
+			err := r.Register(TemplateKey{SECURITY_ALERT, SMS, "en"}, MessageTemplate{Body: tt.body})
+			switch {
+			case tt.invalid == "" && err != nil:
+				t.Fatalf("Register: %v", err)
+			case tt.invalid != "" && (err == nil || !strings.Contains(err.Error(), `"`+tt.invalid+`"`)):
+				t.Fatalf("Register: err = %v, want undeclared %q", err, tt.invalid)
+			}
+		})
+	}
+}
+
+func TestRenderRootVariable(t *testing.T) {
+	r := NewTemplateRegistry()
+	key := TemplateKey{SECURITY_ALERT, SMS, "en"}
+	if err := r.Register(key, MessageTemplate{Body: "{{with .location}}{{.}}: {{$.device}}{{end}}"}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := r.Render(SECURITY_ALERT, SMS, "en", map[string]any{"device": "Chrome", "location": "Pune"})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if msg.Body != "Pune: Chrome" {
+		t.Errorf("body = %q", msg.Body)
+	}
+}
+
+func TestContentEscapesRawEmailMessage(t *testing.T) {
+	n := &Notification{eventType: PROMOTION, message: `<script>alert("x")</script> & more`}
+
+	if got := n.content(EMAIL).Body; got != "&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; &amp; more" {
+		t.Errorf("email body = %q", got)
+	}
+	if got := n.content(SMS).Body; got != n.message {
+		t.Errorf("sms body = %q, want the raw message", got)
+	}
+}
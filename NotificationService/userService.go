@@ -3,15 +3,27 @@ package main
 import (
 	"math/rand"
 	"strconv"
+	"sync"
 )
 
+// ChannelPreference is one step of a fallback chain.
+type ChannelPreference struct {
+	Channel     ChannelType
+	MaxAttempts int // 0 uses the channel's retry policy
+}
+
 type User struct {
 	id                      string
-	notificationPreferences []ChannelType
+	locale                  string
+	contacts                map[ChannelType]string            // email address, phone number, ...
+	notificationPreferences map[EventType][]ChannelPreference // ordered fallback chain per subscribed event type
 }
 
+// UserService is safe for concurrent use; preferences are only changed
+// through its methods.
 type UserService struct {
 	users map[string]*User
+	mu    sync.RWMutex
 }
 
 func NewUserService() *UserService {
@@ -23,20 +35,105 @@ func NewUserService() *UserService {
 func (s *UserService) Create() *User {
 	newUser := &User{
 		id:                      "user" + strconv.Itoa(rand.Intn(1000)),
-		notificationPreferences: make([]ChannelType, 0),
+		locale:                  DefaultLocale,
+		contacts:                make(map[ChannelType]string),
+		notificationPreferences: make(map[EventType][]ChannelPreference),
 	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.users[newUser.id] = newUser
 	return newUser
 }
 
 func (s *UserService) Get(userId string) *User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.users[userId]
 }
 
-func (s *UserService) AddPreference(u *User, t ChannelType) {
-	u.notificationPreferences = append(u.notificationPreferences, t)
+func (s *UserService) SetLocale(u *User, locale string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u.locale = locale
+}
+
+func (s *UserService) Locale(u *User) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return u.locale
+}
+
+// SetContact sets where u is reached on channel c.
+func (s *UserService) SetContact(u *User, c ChannelType, address string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u.contacts[c] = address
+}
+
+func (s *UserService) Contacts(u *User) map[ChannelType]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	contacts := make(map[ChannelType]string, len(u.contacts))
+	for c, addr := range u.contacts {
+		contacts[c] = addr
+	}
+	return contacts
+}
+
+// Subscribe replaces the fallback chain for events of type t with channels,
+// tried in the order given.
+func (s *UserService) Subscribe(u *User, t EventType, channels ...ChannelType) {
+	chain := make([]ChannelPreference, 0, len(channels))
+	for _, c := range channels {
+		chain = append(chain, ChannelPreference{Channel: c})
+	}
+	s.SubscribeWithFallback(u, t, chain...)
+}
+
+// SubscribeWithFallback is Subscribe with a retry budget for each channel.
+func (s *UserService) SubscribeWithFallback(u *User, t EventType, chain ...ChannelPreference) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u.notificationPreferences[t] = append([]ChannelPreference(nil), chain...)
+}
+
+func (s *UserService) Unsubscribe(u *User, t EventType) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(u.notificationPreferences, t)
+}
+
+// AddPreference appends a channel to the end of the fallback chain for
+// events of type t, subscribing u if needed.
+func (s *UserService) AddPreference(u *User, t EventType, c ChannelType) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range u.notificationPreferences[t] {
+		if existing.Channel == c {
+			return
+		}
+	}
+	u.notificationPreferences[t] = append(u.notificationPreferences[t], ChannelPreference{Channel: c})
+}
+
+// FallbackChain returns the channels to try, in order, for events of type t,
+// or nil if u is not subscribed.
+func (s *UserService) FallbackChain(u *User, t EventType) []ChannelPreference {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]ChannelPreference(nil), u.notificationPreferences[t]...)
 }
 
 func (s *UserService) GetAll() map[string]*User {
-	return s.users
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make(map[string]*User, len(s.users))
+	for id, u := range s.users {
+		users[id] = u
+	}
+	return users
 }
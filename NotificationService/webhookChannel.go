@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	WebhookSignatureHeader = "X-Notification-Signature"
+	WebhookTimestampHeader = "X-Notification-Timestamp"
+)
+
+var (
+	ErrWebhookSecretMissing = errors.New("Webhook secret not configured")
+	ErrInvalidSignature     = errors.New("Invalid webhook signature")
+	ErrStaleTimestamp       = errors.New("Webhook timestamp outside tolerance")
+	ErrInvalidWebhookURL    = errors.New("Invalid webhook URL")
+)
+
+// webhookClient is shared by every WebhookChannel so retries and later sends
+// reuse pooled keep-alive connections. Timeouts come from each request's
+// context.
+var webhookClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConnsPerHost: 16,
+		IdleConnTimeout:     90 * time.Second,
+	},
+}
+
+type WebhookSettings struct {
+	Secret  string
+	Timeout time.Duration // per request, including reading the response
+}
+
+type webhookPayload struct {
+	UserId    string    `json:"userId"`
+	EventType EventType `json:"eventType"`
+	Subject   string    `json:"subject,omitempty"`
+	Message   string    `json:"message"`
+	SentAt    time.Time `json:"sentAt"`
+}
+
+// WebhookChannel POSTs notifications as JSON to the user's webhook URL. The
+// body is signed with HMAC-SHA256 over "<timestamp>.<body>" so receivers can
+// check both origin and freshness.
+type WebhookChannel struct {
+	settings WebhookSettings
+	client   *http.Client
+}
+
+func NewWebhookChannel(s WebhookSettings) *WebhookChannel {
+	if s.Timeout <= 0 {
+		s.Timeout = 5 * time.Second
+	}
+	return &WebhookChannel{
+		settings: s,
+		client:   webhookClient,
+	}
+}
+
+// Send treats timeouts, connection failures, 429 and 5xx responses as
+// retryable; any other non-2xx response is permanent.
+func (w *WebhookChannel) Send(n *Notification) error {
+	if w.settings.Secret == "" {
+		return Permanent(ErrWebhookSecretMissing)
+	}
+	target := n.address(WEBHOOK)
+	if target == "" {
+		return Permanent(ErrNoAddress)
+	}
+	if err := checkWebhookURL(target); err != nil {
+		return Permanent(err)
+	}
+
+	msg := n.content(WEBHOOK)
+	now := time.Now()
+	body, err := json.Marshal(webhookPayload{
+		UserId:    n.userId,
+		EventType: n.eventType,
+		Subject:   msg.Subject,
+		Message:   msg.Body,
+		SentAt:    now.UTC(),
+	})
+	if err != nil {
+		return Permanent(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), w.settings.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, signWebhook(w.settings.Secret, timestamp, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("Webhook returned %s", resp.Status)
+	default:
+		return Permanent(fmt.Errorf("Webhook returned %s", resp.Status))
+	}
+}
+
+// checkWebhookURL accepts only absolute http and https URLs, which the client
+// would otherwise reject on every retry.
+func checkWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("%w: %q: %v", ErrInvalidWebhookURL, raw, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: %q", ErrInvalidWebhookURL, raw)
+	}
+	return nil
+}
+
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook is the receiver's side of the signature check. Requests whose
+// timestamp is further than tolerance from now are rejected to stop replays.
+func VerifyWebhook(secret string, r *http.Request, body []byte, tolerance time.Duration) error {
+	timestamp := r.Header.Get(WebhookTimestampHeader)
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := time.Since(time.Unix(sec, 0)); age > tolerance || age < -tolerance {
+		return ErrStaleTimestamp
+	}
+
+	expected := signWebhook(secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get(WebhookSignatureHeader))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret = "whsec_test"
+
+func webhookNotification(url string) *Notification {
+	return &Notification{
+		userId:    "user1",
+		eventType: SECURITY_ALERT,
+		message:   "new login",
+		contacts:  map[ChannelType]string{WEBHOOK: url},
+	}
+}
+
+// webhookDispatcher retries webhook sends up to three times without waiting.
+func webhookDispatcher(ch NotificationChannel) *Dispatcher {
+	d := NewDispatcher()
+	d.sleep = func(time.Duration) {}
+	d.SetChannel(WEBHOOK, ch)
+	d.SetRetryPolicy(WEBHOOK, RetryPolicy{MaxAttempts: 3})
+	return d
+}
+
+func TestWebhookSignatureVerifies(t *testing.T) {
+	var verifyErr, tamperedErr error
+	var payload webhookPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		verifyErr = VerifyWebhook(testWebhookSecret, r, body, time.Minute)
+		tamperedErr = VerifyWebhook(testWebhookSecret, r, append(body, ' '), time.Minute)
+		json.Unmarshal(body, &payload)
+	}))
+	defer srv.Close()
+
+	ch := NewWebhookChannel(WebhookSettings{Secret: testWebhookSecret, Timeout: time.Second})
+	if err := ch.Send(webhookNotification(srv.URL)); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if verifyErr != nil {
+		t.Errorf("signature did not verify: %v", verifyErr)
+	}
+	if !errors.Is(tamperedErr, ErrInvalidSignature) {
+		t.Errorf("tampered body: err = %v, want ErrInvalidSignature", tamperedErr)
+	}
+	if payload.UserId != "user1" || payload.EventType != SECURITY_ALERT || payload.Message != "new login" {
+		t.Errorf("payload = %+v", payload)
+	}
+}
+
+func TestWebhookRetryableFailures(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int // 0 hangs past the channel's timeout
+	}{
+		{"500", http.StatusInternalServerError},
+		{"503", http.StatusServiceUnavailable},
+		{"429", http.StatusTooManyRequests},
+		{"timeout", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			release := make(chan struct{})
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				if tt.status == 0 {
+					select {
+					case <-release:
+					case <-r.Context().Done():
+					}
+					return
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+			defer close(release)
+
+			ch := NewWebhookChannel(WebhookSettings{Secret: testWebhookSecret, Timeout: 50 * time.Millisecond})
+			n := webhookNotification(srv.URL)
+
+			err := ch.Send(n)
+			if err == nil || isPermanent(err) {
+				t.Fatalf("Send: err = %v, want a retryable error", err)
+			}
+
+			calls.Store(0)
+			if err := webhookDispatcher(ch).Deliver(n, WEBHOOK); err == nil {
+				t.Fatal("Deliver succeeded")
+			}
+			if got := calls.Load(); got != 3 {
+				t.Errorf("webhook called %d times, want 3", got)
+			}
+		})
+	}
+}
+
+func TestWebhookClientErrorsArePermanent(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound} {
+		var calls atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(status)
+		}))
+
+		ch := NewWebhookChannel(WebhookSettings{Secret: testWebhookSecret, Timeout: time.Second})
+		if err := webhookDispatcher(ch).Deliver(webhookNotification(srv.URL), WEBHOOK); !isPermanent(err) {
+			t.Errorf("%d: err = %v, want permanent", status, err)
+		}
+		if got := calls.Load(); got != 1 {
+			t.Errorf("%d: webhook called %d times, want 1", status, got)
+		}
+		srv.Close()
+	}
+}
+
+func TestWebhookMissingSecretOrURLIsPermanent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("webhook should not be called")
+	}))
+	defer srv.Close()
+
+	err := NewWebhookChannel(WebhookSettings{}).Send(webhookNotification(srv.URL))
+	if !errors.Is(err, ErrWebhookSecretMissing) || !isPermanent(err) {
+		t.Errorf("missing secret: err = %v, want permanent ErrWebhookSecretMissing", err)
+	}
+
+	err = NewWebhookChannel(WebhookSettings{Secret: testWebhookSecret}).Send(webhookNotification(""))
+	if !errors.Is(err, ErrNoAddress) || !isPermanent(err) {
+		t.Errorf("missing URL: err = %v, want permanent ErrNoAddress", err)
+	}
+
+	ch := NewWebhookChannel(WebhookSettings{Secret: testWebhookSecret})
+	for _, bad := range []string{"ftp://hooks.example.com/notify", "hooks.example.com/notify", "http://", "https:///notify", "http://[::1"} {
+		err := ch.Send(webhookNotification(bad))
+		if !errors.Is(err, ErrInvalidWebhookURL) || !isPermanent(err) {
+			t.Errorf("%q: err = %v, want permanent ErrInvalidWebhookURL", bad, err)
+		}
+	}
+}